@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/timmo001/go-commands/cron"
+	"github.com/timmo001/go-commands/entity"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the config file used when CONFIG_FILE is not set
+const DefaultPath = "config.yml"
+
+// What to do with commands that cannot run on this machine
+const (
+	// UnsupportedHide leaves unsupported commands out of Home Assistant
+	UnsupportedHide = "hide"
+	// UnsupportedShow publishes unsupported commands as unavailable, with the reason as an attribute
+	UnsupportedShow = "show"
+)
+
+// Config holds the settings loaded from the YAML config file
+type Config struct {
+	// Commands are user-defined commands published as buttons
+	Commands []CommandConfig `yaml:"commands"`
+	// Confirm maps commands, as category/command_id, to how long they stay
+	// armed waiting for a second press before they run
+	Confirm map[string]time.Duration `yaml:"confirm"`
+	// UnsupportedCommands is UnsupportedHide or UnsupportedShow
+	UnsupportedCommands string `yaml:"unsupported_commands"`
+	// CommandMaxAge drops command messages whose payload timestamp is older
+	// than this. Zero accepts messages of any age.
+	CommandMaxAge time.Duration `yaml:"command_max_age"`
+	// PowerDelay is how long Shutdown and Restart wait before they run, until
+	// it is changed from Home Assistant
+	PowerDelay time.Duration `yaml:"power_delay"`
+	// Sensors configures how sensor states are published
+	Sensors SensorsConfig `yaml:"sensors"`
+	// Schedules run commands at set times, without Home Assistant
+	Schedules []ScheduleConfig `yaml:"schedules"`
+	// KeepAwake configures the Keep Awake switch
+	KeepAwake KeepAwakeConfig `yaml:"keep_awake"`
+	// Clipboard configures the clipboard entities
+	Clipboard ClipboardConfig `yaml:"clipboard"`
+}
+
+// MaxPowerDelay is the longest power_delay, one day
+const MaxPowerDelay = 24 * time.Hour
+
+// DefaultClipboardMaxSize is the most characters of the clipboard read or set
+// when max_size is not configured
+const DefaultClipboardMaxSize = 255
+
+// ClipboardConfig holds the settings for the clipboard entities
+type ClipboardConfig struct {
+	// Sensor publishes the clipboard contents. It is off by default for privacy.
+	Sensor bool `yaml:"sensor"`
+	// MaxSize is the most characters read from or written to the clipboard
+	MaxSize int `yaml:"max_size"`
+	// Redact lists regular expressions whose matches are hidden from the sensor
+	Redact []string `yaml:"redact"`
+	// RedactSecrets hides contents a password manager marked as secret, defaults to true
+	RedactSecrets *bool `yaml:"redact_secrets"`
+}
+
+// What the Keep Awake switch stops
+const (
+	// KeepAwakeIdle stops the screen blanking or locking and idle suspend
+	KeepAwakeIdle = "idle"
+	// KeepAwakeSleep stops the system suspending or hibernating
+	KeepAwakeSleep = "sleep"
+	// KeepAwakeBoth stops both
+	KeepAwakeBoth = "both"
+)
+
+// KeepAwakeConfig holds the settings for the Keep Awake switch
+type KeepAwakeConfig struct {
+	// Mode is KeepAwakeIdle, KeepAwakeSleep or KeepAwakeBoth
+	Mode string `yaml:"mode"`
+	// Timeout turns the switch off after this long. Zero keeps it on until turned off.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// SensorsConfig holds the settings for published sensors
+type SensorsConfig struct {
+	// Interval is how often sensor states are published
+	Interval time.Duration `yaml:"interval"`
+}
+
+// ScheduleConfig describes a command run on a cron schedule
+type ScheduleConfig struct {
+	Name string `yaml:"name"`
+	// Command is the command to run, as category/command_id
+	Command string `yaml:"command"`
+	// Cron is a five field cron expression, e.g. "0 23 * * 1-5"
+	Cron string `yaml:"cron"`
+	// Idle skips the run unless the user has been idle for at least this long
+	Idle time.Duration `yaml:"idle"`
+	// Enabled is whether the schedule starts enabled, defaults to true
+	Enabled *bool `yaml:"enabled"`
+}
+
+// CommandConfig describes a user-defined command
+type CommandConfig struct {
+	Name        string            `yaml:"name"`
+	Icon        string            `yaml:"icon"`
+	Description string            `yaml:"description"`
+	Command     []string          `yaml:"command"`
+	WorkingDir  string            `yaml:"working_dir"`
+	Env         map[string]string `yaml:"env"`
+	Timeout     time.Duration     `yaml:"timeout"`
+}
+
+// CommandID returns the topic-safe identifier a command is published under,
+// e.g. "Restart to Windows" -> "restart_to_windows"
+func CommandID(name string) string {
+	id := strings.ToLower(name)
+	id = strings.ReplaceAll(id, " ", "_")
+	id = strings.ReplaceAll(id, "/", "_")
+	return id
+}
+
+// validCommandID matches the IDs Home Assistant accepts in discovery topics,
+// which also keeps MQTT wildcards such as # and + out of command topics
+var validCommandID = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Path returns the config file path from the CONFIG_FILE environment variable
+func Path() string {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	return DefaultPath
+}
+
+// Load reads and validates the config file at path.
+// A missing file is not an error and results in an empty config.
+func Load(path string) (*Config, error) {
+	cfg := &Config{UnsupportedCommands: UnsupportedHide, KeepAwake: KeepAwakeConfig{Mode: KeepAwakeBoth}, Clipboard: ClipboardConfig{MaxSize: DefaultClipboardMaxSize}}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %v", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) validate() error {
+	if c.UnsupportedCommands != UnsupportedHide && c.UnsupportedCommands != UnsupportedShow {
+		return fmt.Errorf("unsupported_commands: must be %q or %q", UnsupportedHide, UnsupportedShow)
+	}
+	for command, window := range c.Confirm {
+		category, id, ok := strings.Cut(command, "/")
+		if !ok || category == "" || id == "" || strings.Contains(id, "/") {
+			return fmt.Errorf("confirm %q: expected category/command_id, e.g. power/shutdown", command)
+		}
+		if window <= 0 {
+			return fmt.Errorf("confirm %q: window must be positive", command)
+		}
+	}
+
+	if c.CommandMaxAge < 0 {
+		return fmt.Errorf("command_max_age: must not be negative")
+	}
+
+	if c.PowerDelay < 0 || c.PowerDelay > MaxPowerDelay {
+		return fmt.Errorf("power_delay: must be between 0 and %v", MaxPowerDelay)
+	}
+
+	switch c.KeepAwake.Mode {
+	case KeepAwakeIdle, KeepAwakeSleep, KeepAwakeBoth:
+	default:
+		return fmt.Errorf("keep_awake: mode must be %q, %q or %q", KeepAwakeIdle, KeepAwakeSleep, KeepAwakeBoth)
+	}
+	if c.KeepAwake.Timeout < 0 {
+		return fmt.Errorf("keep_awake: timeout must not be negative")
+	}
+
+	if c.Clipboard.MaxSize <= 0 {
+		return fmt.Errorf("clipboard: max_size must be positive")
+	}
+	for _, pattern := range c.Clipboard.Redact {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("clipboard: invalid redact pattern %q: %v", pattern, err)
+		}
+	}
+
+	if c.Sensors.Interval < 0 {
+		return fmt.Errorf("sensors: interval must not be negative")
+	}
+
+	schedules := map[string]bool{}
+	for i, schedule := range c.Schedules {
+		name := strings.TrimSpace(schedule.Name)
+		if name == "" {
+			return fmt.Errorf("schedules[%d]: name is required", i)
+		}
+		category, id, ok := strings.Cut(schedule.Command, "/")
+		if !ok || category == "" || id == "" || strings.Contains(id, "/") {
+			return fmt.Errorf("schedule %q: command must be category/command_id, e.g. power/lock", schedule.Name)
+		}
+		if _, err := cron.Parse(schedule.Cron); err != nil {
+			return fmt.Errorf("schedule %q: invalid cron expression: %v", schedule.Name, err)
+		}
+		if schedule.Idle < 0 {
+			return fmt.Errorf("schedule %q: idle must not be negative", schedule.Name)
+		}
+		// Schedules are published under their entity ID
+		key := entity.ID(name)
+		if schedules[key] {
+			return fmt.Errorf("schedule %q: duplicate name, another schedule has the ID %s", schedule.Name, key)
+		}
+		schedules[key] = true
+	}
+
+	names := map[string]bool{}
+	for i, cmd := range c.Commands {
+		name := strings.TrimSpace(cmd.Name)
+		if name == "" {
+			return fmt.Errorf("commands[%d]: name is required", i)
+		}
+		if len(cmd.Command) == 0 || cmd.Command[0] == "" {
+			return fmt.Errorf("command %q: command is required", cmd.Name)
+		}
+		if cmd.Timeout < 0 {
+			return fmt.Errorf("command %q: timeout must not be negative", cmd.Name)
+		}
+		// Commands are published under their ID, so names must differ in it
+		key := CommandID(name)
+		if !validCommandID.MatchString(key) {
+			return fmt.Errorf("command %q: name gives the ID %s, which may only contain letters a to z, digits, spaces, _, - and /", cmd.Name, key)
+		}
+		if names[key] {
+			return fmt.Errorf("command %q: duplicate name, another command has the ID %s", cmd.Name, key)
+		}
+		names[key] = true
+	}
+	return nil
+}
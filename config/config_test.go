@@ -0,0 +1,188 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCommands(t *testing.T) {
+	path := writeConfig(t, `
+commands:
+  - name: Backup
+    icon: mdi:backup-restore
+    command: ["./backup.sh", "--all"]
+    working_dir: /srv/scripts
+    env:
+      TARGET: /mnt/backup
+    timeout: 90s
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(cfg.Commands))
+	}
+
+	cmd := cfg.Commands[0]
+	if cmd.Name != "Backup" || cmd.Icon != "mdi:backup-restore" || cmd.WorkingDir != "/srv/scripts" {
+		t.Errorf("unexpected command: %+v", cmd)
+	}
+	if len(cmd.Command) != 2 || cmd.Command[0] != "./backup.sh" || cmd.Command[1] != "--all" {
+		t.Errorf("command = %q", cmd.Command)
+	}
+	if cmd.Env["TARGET"] != "/mnt/backup" {
+		t.Errorf("env = %v", cmd.Env)
+	}
+	if cmd.Timeout != 90*time.Second {
+		t.Errorf("timeout = %v, want 90s", cmd.Timeout)
+	}
+}
+
+func TestLoadSensors(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "sensors:\n  interval: 10s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.UnsupportedCommands != UnsupportedHide {
+		t.Errorf("unsupported_commands = %q, want the hide default", cfg.UnsupportedCommands)
+	}
+	if cfg.Sensors.Interval != 10*time.Second {
+		t.Errorf("interval = %v, want 10s", cfg.Sensors.Interval)
+	}
+}
+
+func TestLoadCommandMaxAge(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "command_max_age: 2m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.CommandMaxAge != 2*time.Minute {
+		t.Errorf("command_max_age = %v, want 2m", cfg.CommandMaxAge)
+	}
+}
+
+func TestLoadPowerDelay(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "power_delay: 5m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.PowerDelay != 5*time.Minute {
+		t.Errorf("power_delay = %v, want 5m", cfg.PowerDelay)
+	}
+}
+
+func TestLoadSchedules(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `schedules:
+  - name: Lock at Night
+    command: power/lock
+    cron: "0 23 * * 1-5"
+  - name: Shutdown if Idle
+    command: power/shutdown
+    cron: "0 1 * * *"
+    idle: 30m
+    enabled: false
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Schedules) != 2 {
+		t.Fatalf("got %d schedules, want 2", len(cfg.Schedules))
+	}
+	if s := cfg.Schedules[0]; s.Command != "power/lock" || s.Cron != "0 23 * * 1-5" || s.Enabled != nil {
+		t.Errorf("unexpected schedule: %+v", s)
+	}
+	if s := cfg.Schedules[1]; s.Idle != 30*time.Minute || s.Enabled == nil || *s.Enabled {
+		t.Errorf("unexpected schedule: %+v", s)
+	}
+}
+
+func TestLoadKeepAwake(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "keep_awake:\n  timeout: 2h\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.KeepAwake.Mode != KeepAwakeBoth || cfg.KeepAwake.Timeout != 2*time.Hour {
+		t.Errorf("keep_awake = %+v, want both with a 2h timeout", cfg.KeepAwake)
+	}
+}
+
+func TestLoadClipboard(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "clipboard:\n  sensor: true\n  redact: [\"ghp_\\\\w+\"]\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Clipboard.Sensor || cfg.Clipboard.MaxSize != DefaultClipboardMaxSize || cfg.Clipboard.RedactSecrets != nil {
+		t.Errorf("clipboard = %+v", cfg.Clipboard)
+	}
+	if len(cfg.Clipboard.Redact) != 1 || cfg.Clipboard.Redact[0] != `ghp_\w+` {
+		t.Errorf("redact = %q", cfg.Clipboard.Redact)
+	}
+}
+
+func TestLoadConfirm(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "confirm:\n  power/shutdown: 10s\n  custom/backup: 1m\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Confirm["power/shutdown"] != 10*time.Second || cfg.Confirm["custom/backup"] != time.Minute {
+		t.Errorf("confirm = %v", cfg.Confirm)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	cfg, err := Load(filepath.Join(t.TempDir(), "missing.yml"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Commands) != 0 {
+		t.Errorf("expected no commands, got %d", len(cfg.Commands))
+	}
+}
+
+func TestLoadInvalidCommands(t *testing.T) {
+	tests := map[string]string{
+		"missing name":       "commands:\n  - command: [\"true\"]\n",
+		"missing command":    "commands:\n  - name: Test\n",
+		"duplicate name":     "commands:\n  - name: Test\n    command: [\"true\"]\n  - name: test\n    command: [\"false\"]\n",
+		"duplicate ID":       "commands:\n  - name: Foo Bar\n    command: [\"true\"]\n  - name: foo_bar\n    command: [\"false\"]\n",
+		"wildcard name":      "commands:\n  - name: C# Build\n    command: [\"true\"]\n",
+		"unicode name":       "commands:\n  - name: Grüße\n    command: [\"true\"]\n",
+		"duplicate schedule": "schedules:\n  - name: Lock at Night\n    command: power/lock\n    cron: \"0 23 * * *\"\n  - name: lock-at-night\n    command: power/lock\n    cron: \"0 22 * * *\"\n",
+		"bad timeout":        "commands:\n  - name: Test\n    command: [\"true\"]\n    timeout: soon\n",
+		"negative interval":  "sensors:\n  interval: -1s\n",
+		"unsupported mode":   "unsupported_commands: maybe\n",
+		"confirm path":       "confirm:\n  shutdown: 10s\n",
+		"confirm window":     "confirm:\n  power/shutdown: 0s\n",
+		"negative max age":   "command_max_age: -1m\n",
+		"power delay":        "power_delay: 25h\n",
+		"schedule command":   "schedules:\n  - name: Night\n    command: lock\n    cron: \"0 23 * * *\"\n",
+		"schedule cron":      "schedules:\n  - name: Night\n    command: power/lock\n    cron: \"0 25 * * *\"\n",
+		"keep awake mode":    "keep_awake:\n  mode: forever\n",
+		"keep awake time":    "keep_awake:\n  timeout: -1h\n",
+		"clipboard size":     "clipboard:\n  max_size: 0\n",
+		"clipboard redact":   "clipboard:\n  redact: [\"(\"]\n",
+		"schedule name":      "schedules:\n  - command: power/lock\n    cron: \"0 23 * * *\"\n",
+	}
+
+	for name, contents := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, contents)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
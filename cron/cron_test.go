@@ -0,0 +1,77 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// A Wednesday
+	from := time.Date(2024, 5, 1, 12, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 1, 12, 31, 0, 0, time.UTC)},
+		{"0 23 * * 1-5", time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)},
+		{"0 23 * * sat,sun", time.Date(2024, 5, 4, 23, 0, 0, 0, time.UTC)},
+		{"0 1 * * 7", time.Date(2024, 5, 5, 1, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 1, 12, 45, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 5, 1, 12, 45, 0, 0, time.UTC)},
+		{"30 12 * * *", time.Date(2024, 5, 2, 12, 30, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are set
+		{"0 9 15 * mon", time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		// unless one matches every day, however it is written
+		{"0 9 */1 * mon", time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 9 ? * mon", time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 9 1-31 * mon", time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 9 15 * 0-6", time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 9 15 * 1-7", time.Date(2024, 5, 15, 9, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := Parse(tt.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextNever(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next = %v, want the zero time", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"@sometimes",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Entity is a Home Assistant entity with state, such as a sensor, number or switch
+type Entity struct {
+	// Component is the Home Assistant platform, e.g. sensor or switch
+	Component string
+	// ID identifies the entity within its component, e.g. cpu_usage
+	ID string
+	// Name is shown in Home Assistant
+	Name string
+	// Icon is a Material Design icon, e.g. mdi:cpu-64-bit
+	Icon string
+	// Config holds extra discovery fields such as device_class or unit_of_measurement
+	Config map[string]any
+	// DynamicConfig returns discovery fields that change at runtime, such as
+	// the options of a select. Discovery is published again when they change.
+	DynamicConfig func() (map[string]any, error)
+	// State returns the current state. It is polled on the update interval,
+	// and read again whenever Watch reports a change.
+	State func() (any, error)
+	// Retain publishes the state as a retained message, so Home Assistant
+	// shows the real value, such as a setting, before it is next published
+	Retain bool
+	// Attributes returns extra state attributes, published as JSON to the attributes topic
+	Attributes func() (map[string]any, error)
+	// Command handles payloads sent to the entity's command topic
+	Command func(payload string) error
+	// Watch blocks until stop is closed, calling changed whenever the state
+	// changes so it is published immediately rather than on the next poll
+	Watch func(changed func(), stop <-chan struct{})
+	// Events blocks until stop is closed, calling fire with each event to
+	// publish. Unlike states, events are never republished.
+	Events func(fire func(payload any), stop <-chan struct{})
+}
+
+// ObjectID returns the discovery object ID, unique within the component
+func (e Entity) ObjectID() string {
+	return e.ID
+}
+
+// Topic returns the MQTT topic for one of the entity's channels, e.g. state or set
+func (e Entity) Topic(baseTopic, channel string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", baseTopic, e.Component, e.ID, channel)
+}
+
+// DiscoveryConfig returns the Home Assistant discovery configuration for the entity
+func (e Entity) DiscoveryConfig(device map[string]any, uniqueID, baseTopic string) map[string]any {
+	config := map[string]any{
+		"name":               e.Name,
+		"unique_id":          fmt.Sprintf("%s_%s_%s", uniqueID, e.Component, e.ID),
+		"availability_topic": fmt.Sprintf("%s/availability", baseTopic),
+		"device":             device,
+	}
+	if e.Icon != "" {
+		config["icon"] = e.Icon
+	}
+	if e.State != nil {
+		config["state_topic"] = e.Topic(baseTopic, "state")
+	}
+	if e.Events != nil {
+		config["state_topic"] = e.Topic(baseTopic, "event")
+	}
+	if e.Attributes != nil {
+		config["json_attributes_topic"] = e.Topic(baseTopic, "attributes")
+	}
+	if e.Command != nil {
+		config["command_topic"] = e.Topic(baseTopic, "set")
+	}
+	for key, value := range e.Config {
+		config[key] = value
+	}
+	return config
+}
+
+// ID returns a topic-safe identifier for a name, e.g. "Disk Usage /home" -> "disk_usage_home"
+func ID(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore && b.Len() > 0 {
+			b.WriteRune('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
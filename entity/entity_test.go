@@ -0,0 +1,49 @@
+package entity
+
+import "testing"
+
+func TestDiscoveryConfig(t *testing.T) {
+	device := map[string]any{"name": "Test"}
+	e := Entity{
+		Component: "sensor",
+		ID:        "cpu_usage",
+		Name:      "CPU Usage",
+		Icon:      "mdi:cpu-64-bit",
+		Config:    map[string]any{"unit_of_measurement": "%"},
+		State:     func() (any, error) { return 12.5, nil },
+	}
+
+	config := e.DiscoveryConfig(device, "node", "base")
+	want := map[string]string{
+		"name":                "CPU Usage",
+		"unique_id":           "node_sensor_cpu_usage",
+		"state_topic":         "base/sensor/cpu_usage/state",
+		"availability_topic":  "base/availability",
+		"icon":                "mdi:cpu-64-bit",
+		"unit_of_measurement": "%",
+	}
+	for key, value := range want {
+		if config[key] != value {
+			t.Errorf("%s = %v, want %q", key, config[key], value)
+		}
+	}
+	for _, key := range []string{"command_topic", "json_attributes_topic"} {
+		if _, ok := config[key]; ok {
+			t.Errorf("unexpected %s", key)
+		}
+	}
+}
+
+func TestID(t *testing.T) {
+	tests := map[string]string{
+		"CPU Usage":           "cpu_usage",
+		"Disk Usage /home":    "disk_usage_home",
+		"Disk Usage /mnt/My ": "disk_usage_mnt_my",
+		"Load Average (1m)":   "load_average_1m",
+	}
+	for name, want := range tests {
+		if got := ID(name); got != want {
+			t.Errorf("ID(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package entity
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/mqtt"
+)
+
+// DefaultInterval is how often entity states are polled when no interval is configured
+const DefaultInterval = 30 * time.Second
+
+// Manager publishes entities to Home Assistant and keeps their states up to date
+type Manager struct {
+	client    mqtt.Client
+	device    map[string]any
+	uniqueID  string
+	baseTopic string
+	interval  time.Duration
+
+	mu       sync.Mutex
+	entities []Entity
+	// discovered holds the last discovery config published for each dynamic entity
+	discovered map[string]string
+	stop       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewManager creates a Manager that publishes entities for a device
+func NewManager(client mqtt.Client, device map[string]any, uniqueID, baseTopic string, interval time.Duration) *Manager {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Manager{
+		client:     client,
+		device:     device,
+		uniqueID:   uniqueID,
+		baseTopic:  baseTopic,
+		interval:   interval,
+		discovered: map[string]string{},
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start publishes every registered entity, subscribes to their command
+// topics and starts publishing their states
+func (m *Manager) Start() {
+	for _, provider := range Providers() {
+		for _, e := range provider.Entities() {
+			m.Add(e)
+		}
+	}
+
+	m.wg.Add(1)
+	go m.poll()
+}
+
+// Stop stops publishing states and waits for watchers to exit
+func (m *Manager) Stop() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// Add publishes an entity and starts keeping its state up to date
+func (m *Manager) Add(e Entity) {
+	m.mu.Lock()
+	m.entities = append(m.entities, e)
+	m.mu.Unlock()
+
+	m.discover(e)
+
+	if e.Command != nil {
+		err := m.client.SubscribeCommand(e.Topic(m.baseTopic, "set"), func(msg mqtt.Message) error {
+			return m.handleCommand(e, string(msg.Payload))
+		})
+		if err != nil {
+			log.Error("Failed to subscribe to entity command topic", "error", err, "component", e.Component, "entity", e.ID)
+		}
+	}
+
+	m.publish(e)
+
+	if e.Watch != nil {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			e.Watch(func() { m.publish(e) }, m.stop)
+		}()
+	}
+
+	if e.Events != nil {
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			e.Events(func(payload any) { m.fire(e, payload) }, m.stop)
+		}()
+	}
+}
+
+// Entities returns every entity the manager has published
+func (m *Manager) Entities() []Entity {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entities := make([]Entity, len(m.entities))
+	copy(entities, m.entities)
+	return entities
+}
+
+// Refresh publishes the current state of an entity immediately
+func (m *Manager) Refresh(component, id string) {
+	for _, e := range m.Entities() {
+		if e.Component == component && e.ID == id {
+			m.publish(e)
+		}
+	}
+}
+
+func (m *Manager) handleCommand(e Entity, payload string) error {
+	log.Info("Setting entity", "component", e.Component, "entity", e.ID, "payload", payload)
+	err := e.Command(payload)
+	if err != nil {
+		log.Error("Failed to set entity", "error", err, "component", e.Component, "entity", e.ID)
+	}
+
+	// Report the real state back, whether or not the command worked
+	m.publish(e)
+	return err
+}
+
+// fire publishes an event of an entity
+func (m *Manager) fire(e Entity, payload any) {
+	if err := m.client.Publish(e.Topic(m.baseTopic, "event"), 1, false, payload); err != nil {
+		log.Error("Failed to publish entity event", "error", err, "component", e.Component, "entity", e.ID)
+	}
+}
+
+// poll publishes the state of every entity on the update interval
+func (m *Manager) poll() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			for _, e := range m.Entities() {
+				m.publish(e)
+			}
+		}
+	}
+}
+
+// discover publishes the discovery config of an entity, unless its dynamic
+// config is unchanged since it was last published
+func (m *Manager) discover(e Entity) {
+	config := e.DiscoveryConfig(m.device, m.uniqueID, m.baseTopic)
+
+	if e.DynamicConfig != nil {
+		dynamic, err := e.DynamicConfig()
+		if err != nil {
+			log.Debug("Failed to read entity config", "error", err, "component", e.Component, "entity", e.ID)
+			return
+		}
+		for key, value := range dynamic {
+			config[key] = value
+		}
+
+		encoded, err := json.Marshal(config)
+		if err != nil {
+			log.Error("Failed to encode entity discovery message", "error", err, "component", e.Component, "entity", e.ID)
+			return
+		}
+		key := e.Component + "/" + e.ID
+		m.mu.Lock()
+		unchanged := m.discovered[key] == string(encoded)
+		m.discovered[key] = string(encoded)
+		m.mu.Unlock()
+		if unchanged {
+			return
+		}
+	}
+
+	if err := m.client.PublishDiscovery(e.Component, m.uniqueID, e.ObjectID(), config); err != nil {
+		log.Error("Failed to publish entity discovery message", "error", err, "component", e.Component, "entity", e.ID)
+	}
+}
+
+// publish reads and publishes the state and attributes of an entity
+func (m *Manager) publish(e Entity) {
+	// Publish new options before a state that may depend on them
+	if e.DynamicConfig != nil {
+		m.discover(e)
+	}
+
+	if e.State != nil {
+		state, err := e.State()
+		if err != nil {
+			log.Debug("Failed to read entity state", "error", err, "component", e.Component, "entity", e.ID)
+		} else if err := m.publishState(e, state); err != nil {
+			log.Error("Failed to publish entity state", "error", err, "component", e.Component, "entity", e.ID)
+		}
+	}
+
+	if e.Attributes != nil {
+		attributes, err := e.Attributes()
+		if err != nil {
+			log.Debug("Failed to read entity attributes", "error", err, "component", e.Component, "entity", e.ID)
+		} else if err := m.client.PublishState(e.Topic(m.baseTopic, "attributes"), attributes); err != nil {
+			log.Error("Failed to publish entity attributes", "error", err, "component", e.Component, "entity", e.ID)
+		}
+	}
+}
+
+// publishState publishes the state of an entity, retained if the entity asks for it
+func (m *Manager) publishState(e Entity, state any) error {
+	topic := e.Topic(m.baseTopic, "state")
+	if e.Retain {
+		return m.client.Publish(topic, 1, true, state)
+	}
+	return m.client.PublishState(topic, state)
+}
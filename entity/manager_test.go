@@ -0,0 +1,208 @@
+package entity
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/mqtt"
+)
+
+// fakeClient records what the manager publishes
+type fakeClient struct {
+	mu        sync.Mutex
+	discovery []map[string]any
+	states    map[string]any
+	published map[string][]any
+	retained  map[string]bool
+	handlers  map[string]mqtt.MessageHandler
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{states: map[string]any{}, published: map[string][]any{}, retained: map[string]bool{}, handlers: map[string]mqtt.MessageHandler{}}
+}
+
+func (c *fakeClient) Connect() error              { return nil }
+func (c *fakeClient) Disconnect()                 {}
+func (c *fakeClient) DiscoveryTopics() []string   { return nil }
+func (c *fakeClient) ClearDiscovery(string) error { return nil }
+func (c *fakeClient) IsConnected() bool           { return true }
+func (c *fakeClient) OnRediscover(func())         {}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published[topic] = append(c.published[topic], payload)
+	c.retained[topic] = retained
+	return nil
+}
+
+func (c *fakeClient) PublishDiscovery(component, nodeID, objectID string, config interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.discovery = append(c.discovery, config.(map[string]any))
+	return nil
+}
+
+func (c *fakeClient) PublishState(topic string, payload interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[topic] = payload
+	return nil
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[topic] = callback
+	return nil
+}
+
+func (c *fakeClient) SubscribeCommand(topic string, callback mqtt.MessageHandler) error {
+	return c.Subscribe(topic, 1, callback)
+}
+
+func (c *fakeClient) state(topic string) any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.states[topic]
+}
+
+func (c *fakeClient) discoveries() []map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]map[string]any(nil), c.discovery...)
+}
+
+func TestManagerCommand(t *testing.T) {
+	client := newFakeClient()
+	manager := NewManager(client, map[string]any{}, "node", "base", time.Hour)
+	defer manager.Stop()
+
+	level := 10
+	manager.Add(Entity{
+		Component: "number",
+		ID:        "level",
+		Name:      "Level",
+		State:     func() (any, error) { return level, nil },
+		Command: func(payload string) error {
+			level = 42
+			return nil
+		},
+	})
+
+	if got := client.state("base/number/level/state"); got != 10 {
+		t.Errorf("initial state = %v, want 10", got)
+	}
+
+	handler := client.handlers["base/number/level/set"]
+	if handler == nil {
+		t.Fatal("command topic not subscribed")
+	}
+	if err := handler(mqtt.Message{Payload: []byte("42")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := client.state("base/number/level/state"); got != 42 {
+		t.Errorf("state after command = %v, want 42", got)
+	}
+}
+
+func TestManagerRetainsState(t *testing.T) {
+	client := newFakeClient()
+	manager := NewManager(client, map[string]any{}, "node", "base", time.Hour)
+	defer manager.Stop()
+
+	manager.Add(Entity{
+		Component: "number",
+		ID:        "delay",
+		Name:      "Delay",
+		State:     func() (any, error) { return 5, nil },
+		Retain:    true,
+	})
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if got := client.published["base/number/delay/state"]; len(got) != 1 || got[0] != 5 || !client.retained["base/number/delay/state"] {
+		t.Errorf("published %v, retained %v, want 5 retained", got, client.retained["base/number/delay/state"])
+	}
+	if _, ok := client.states["base/number/delay/state"]; ok {
+		t.Error("retained state was also published as a plain state")
+	}
+}
+
+func TestManagerRepublishesDynamicConfig(t *testing.T) {
+	client := newFakeClient()
+	manager := NewManager(client, map[string]any{}, "node", "base", time.Hour)
+
+	options := []string{"a"}
+	var mu sync.Mutex
+	changed := make(chan func(), 1)
+	manager.Add(Entity{
+		Component: "select",
+		ID:        "choice",
+		Name:      "Choice",
+		DynamicConfig: func() (map[string]any, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return map[string]any{"options": append([]string(nil), options...)}, nil
+		},
+		State: func() (any, error) { return "a", nil },
+		Watch: func(notify func(), stop <-chan struct{}) {
+			changed <- notify
+			<-stop
+		},
+	})
+	notify := <-changed
+
+	// Publishing the state again without new options does not republish discovery
+	notify()
+	if got := len(client.discoveries()); got != 1 {
+		t.Fatalf("discovery published %d times, want 1", got)
+	}
+
+	mu.Lock()
+	options = append(options, "b")
+	mu.Unlock()
+	notify()
+
+	discoveries := client.discoveries()
+	if len(discoveries) != 2 {
+		t.Fatalf("discovery published %d times, want 2", len(discoveries))
+	}
+	if got := discoveries[1]["options"].([]string); len(got) != 2 {
+		t.Errorf("options = %v, want a and b", got)
+	}
+
+	manager.Stop()
+}
+
+func TestManagerEvents(t *testing.T) {
+	client := newFakeClient()
+	manager := NewManager(client, map[string]any{}, "node", "base", time.Hour)
+
+	fired := make(chan struct{})
+	manager.Add(Entity{
+		Component: "event",
+		ID:        "clicked",
+		Name:      "Clicked",
+		Events: func(fire func(payload any), stop <-chan struct{}) {
+			fire(map[string]any{"event_type": "press"})
+			close(fired)
+			<-stop
+		},
+	})
+	<-fired
+	manager.Stop()
+
+	if got := client.discoveries()[0]["state_topic"]; got != "base/event/clicked/event" {
+		t.Errorf("state_topic = %v, want the event topic", got)
+	}
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	if got := client.published["base/event/clicked/event"]; len(got) != 1 {
+		t.Errorf("published %d events, want 1", len(got))
+	}
+	if len(client.states) != 0 {
+		t.Errorf("events were remembered as states: %v", client.states)
+	}
+}
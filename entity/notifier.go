@@ -0,0 +1,59 @@
+package entity
+
+import "sync"
+
+// Notifier calls the functions watching something whenever it changes. Embed
+// it to give a type a Watch method to use as an entity's Watch. The zero
+// value is ready to use.
+type Notifier struct {
+	mu       sync.Mutex
+	watchers map[int]func()
+	nextID   int
+}
+
+// Watch calls changed on every Notify until stop is closed
+func (n *Notifier) Watch(changed func(), stop <-chan struct{}) {
+	remove := n.AddWatcher(changed)
+	<-stop
+	remove()
+}
+
+// AddWatcher calls changed on every Notify until the returned function is called
+func (n *Notifier) AddWatcher(changed func()) func() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.watchers == nil {
+		n.watchers = map[int]func(){}
+	}
+	id := n.nextID
+	n.nextID++
+	n.watchers[id] = changed
+	return func() {
+		n.mu.Lock()
+		delete(n.watchers, id)
+		n.mu.Unlock()
+	}
+}
+
+// Watching returns how many functions are watching
+func (n *Notifier) Watching() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return len(n.watchers)
+}
+
+// Notify calls every watching function
+func (n *Notifier) Notify() {
+	n.mu.Lock()
+	watchers := make([]func(), 0, len(n.watchers))
+	for _, watcher := range n.watchers {
+		watchers = append(watchers, watcher)
+	}
+	n.mu.Unlock()
+
+	for _, watcher := range watchers {
+		watcher()
+	}
+}
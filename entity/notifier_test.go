@@ -0,0 +1,38 @@
+package entity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNotifier(t *testing.T) {
+	var n Notifier
+	n.Notify()
+
+	changes := make(chan struct{}, 4)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		n.Watch(func() { changes <- struct{}{} }, stop)
+		close(done)
+	}()
+	for n.Watching() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	n.Notify()
+	n.Notify()
+	if len(changes) != 2 {
+		t.Errorf("got %d changes, want 2", len(changes))
+	}
+
+	close(stop)
+	<-done
+	if got := n.Watching(); got != 0 {
+		t.Errorf("%d functions still watching after stop", got)
+	}
+	n.Notify()
+	if len(changes) != 2 {
+		t.Errorf("got %d changes after stop, want 2", len(changes))
+	}
+}
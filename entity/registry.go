@@ -0,0 +1,41 @@
+package entity
+
+import "sync"
+
+// Provider is a named group of entities, such as system sensors
+type Provider struct {
+	// Name identifies the provider in logs, e.g. "system"
+	Name string
+	// Entities returns the entities available from this provider
+	Entities func() []Entity
+}
+
+var (
+	registryMu sync.RWMutex
+	providers  []Provider
+)
+
+// Register adds an entity provider to the registry. Registering a name
+// that already exists replaces the previous provider.
+func Register(name string, entities func() []Entity) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i, provider := range providers {
+		if provider.Name == name {
+			providers[i].Entities = entities
+			return
+		}
+	}
+	providers = append(providers, Provider{Name: name, Entities: entities})
+}
+
+// Providers returns all registered entity providers in registration order
+func Providers() []Provider {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	result := make([]Provider, len(providers))
+	copy(result, providers)
+	return result
+}
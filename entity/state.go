@@ -0,0 +1,12 @@
+package entity
+
+// Unknown is the state payload that Home Assistant shows as unknown
+const Unknown = "None"
+
+// OnOff returns the default binary_sensor and switch payload for a boolean state
+func OnOff(on bool) string {
+	if on {
+		return "ON"
+	}
+	return "OFF"
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/mqtt"
+)
+
+// mqttConfigFromEnv builds the MQTT client configuration from environment variables
+func mqttConfigFromEnv(clientID, availabilityTopic string) mqtt.Config {
+	scheme := os.Getenv("MQTT_SCHEME")
+	if scheme == "" {
+		scheme = "tcp"
+	}
+
+	// Create MQTT broker URL
+	brokerURL := fmt.Sprintf("%s://%s:%s%s", scheme, os.Getenv("MQTT_HOST"), os.Getenv("MQTT_PORT"), os.Getenv("MQTT_PATH"))
+
+	protocolVersion := 3
+	if value := os.Getenv("MQTT_PROTOCOL_VERSION"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			log.Warn("Invalid MQTT protocol version, using 3", "value", value)
+		} else {
+			protocolVersion = parsed
+		}
+	}
+
+	return mqtt.Config{
+		BrokerURL:         brokerURL,
+		Username:          os.Getenv("MQTT_USER"),
+		Password:          os.Getenv("MQTT_PASSWORD"),
+		ProtocolVersion:   protocolVersion,
+		ClientID:          clientID,
+		PersistentSession: envBool("MQTT_PERSISTENT_SESSION"),
+		AvailabilityTopic: availabilityTopic,
+		BirthTopic:        os.Getenv("HOMEASSISTANT_BIRTH_TOPIC"),
+		TLS: mqtt.TLSConfig{
+			CAFile:             os.Getenv("MQTT_CA_FILE"),
+			CertFile:           os.Getenv("MQTT_CERT_FILE"),
+			KeyFile:            os.Getenv("MQTT_KEY_FILE"),
+			ServerName:         os.Getenv("MQTT_SERVER_NAME"),
+			InsecureSkipVerify: envBool("MQTT_INSECURE_SKIP_VERIFY"),
+		},
+	}
+}
+
+// manifestPathFromEnv returns the manifest path from the MANIFEST_FILE environment variable
+func manifestPathFromEnv() string {
+	if path := os.Getenv("MANIFEST_FILE"); path != "" {
+		return path
+	}
+	return mqtt.DefaultManifestPath
+}
+
+// envBool parses a boolean environment variable, treating unset or invalid values as false
+func envBool(key string) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return false
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warn("Invalid boolean environment variable", "key", key, "value", value)
+		return false
+	}
+	return parsed
+}
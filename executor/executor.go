@@ -0,0 +1,126 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Cmd describes an external process to run
+type Cmd struct {
+	// Name is the program to run, looked up in PATH if it has no separators
+	Name string
+	// Args are the arguments passed to the program
+	Args []string
+	// Dir is the working directory, or the current directory if empty
+	Dir string
+	// Env holds extra KEY=value pairs appended to the current environment
+	Env []string
+	// Timeout kills the process if it runs for longer, zero means no limit
+	Timeout time.Duration
+	// Stdin is written to the process's standard input
+	Stdin string
+}
+
+// Command returns a Cmd for the given program and arguments
+func Command(name string, args ...string) Cmd {
+	return Cmd{Name: name, Args: args}
+}
+
+// Argv returns the program name followed by its arguments
+func (c Cmd) Argv() []string {
+	return append([]string{c.Name}, c.Args...)
+}
+
+// Executor runs external processes
+type Executor interface {
+	// Run runs the command and waits for it to finish
+	Run(cmd Cmd) error
+	// Output runs the command and returns its standard output
+	Output(cmd Cmd) ([]byte, error)
+	// Stream runs the command, calling line for each line of standard output,
+	// until it exits or stop is closed
+	Stream(cmd Cmd, line func(string), stop <-chan struct{}) error
+	// LookPath returns the path of an installed program
+	LookPath(name string) (string, error)
+}
+
+// System is an Executor that runs processes on the host
+type System struct{}
+
+// Run runs the command on the host and waits for it to finish
+func (System) Run(cmd Cmd) error {
+	c, cancel := build(cmd)
+	defer cancel()
+	return c.Run()
+}
+
+// Output runs the command on the host and returns its standard output
+func (System) Output(cmd Cmd) ([]byte, error) {
+	c, cancel := build(cmd)
+	defer cancel()
+	return c.Output()
+}
+
+// Stream runs the command on the host, calling line for each line of
+// standard output, until it exits or stop is closed
+func (System) Stream(cmd Cmd, line func(string), stop <-chan struct{}) error {
+	c, cancel := build(cmd)
+	defer cancel()
+
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			c.Process.Kill()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line(scanner.Text())
+	}
+	err = c.Wait()
+
+	select {
+	case <-stop:
+		return nil
+	default:
+		return err
+	}
+}
+
+// LookPath searches PATH for an installed program
+func (System) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func build(cmd Cmd) (*exec.Cmd, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if cmd.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+	}
+
+	c := exec.CommandContext(ctx, cmd.Name, cmd.Args...)
+	c.Dir = cmd.Dir
+	if cmd.Stdin != "" {
+		c.Stdin = strings.NewReader(cmd.Stdin)
+	}
+	if len(cmd.Env) > 0 {
+		c.Env = append(os.Environ(), cmd.Env...)
+	}
+	return c, cancel
+}
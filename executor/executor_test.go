@@ -0,0 +1,73 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSystemOutputWithDirAndEnv(t *testing.T) {
+	dir := t.TempDir()
+
+	output, err := System{}.Output(Cmd{
+		Name: "sh",
+		Args: []string{"-c", `echo "$PWD $GO_COMMANDS_TEST"`},
+		Dir:  dir,
+		Env:  []string{"GO_COMMANDS_TEST=value"},
+	})
+	if err != nil {
+		t.Skipf("sh is not available: %v", err)
+	}
+
+	if got, want := strings.TrimSpace(string(output)), dir+" value"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestSystemOutputWithStdin(t *testing.T) {
+	output, err := System{}.Output(Cmd{Name: "cat", Stdin: "from stdin"})
+	if err != nil {
+		t.Skipf("cat is not available: %v", err)
+	}
+
+	if got := string(output); got != "from stdin" {
+		t.Errorf("output = %q, want the input", got)
+	}
+}
+
+func TestSystemRunTimeout(t *testing.T) {
+	start := time.Now()
+	err := System{}.Run(Cmd{Name: "sleep", Args: []string{"5"}, Timeout: 100 * time.Millisecond})
+	if err == nil {
+		t.Fatal("expected the command to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command ran for %v despite the timeout", elapsed)
+	}
+}
+
+func TestSystemStream(t *testing.T) {
+	var lines []string
+	err := System{}.Stream(Command("sh", "-c", "echo one; echo two"), func(line string) {
+		lines = append(lines, line)
+	}, make(chan struct{}))
+	if err != nil {
+		t.Skipf("sh is not available: %v", err)
+	}
+	if strings.Join(lines, ",") != "one,two" {
+		t.Errorf("lines = %q", lines)
+	}
+}
+
+func TestSystemStreamStop(t *testing.T) {
+	stop := make(chan struct{})
+	time.AfterFunc(100*time.Millisecond, func() { close(stop) })
+
+	start := time.Now()
+	if err := (System{}).Stream(Command("sleep", "5"), func(string) {}, stop); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command ran for %v after stop", elapsed)
+	}
+}
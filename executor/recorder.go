@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Recorder is a fake Executor that records every command instead of running it.
+// Results can be scripted per command line (e.g. "systemctl suspend") or per
+// program name (e.g. "systemctl"); the full command line takes precedence.
+// Every program is assumed to be installed unless listed in Missing.
+type Recorder struct {
+	mu      sync.Mutex
+	calls   []Cmd
+	Errors  map[string]error
+	Outputs map[string][]byte
+	Streams map[string][]string
+	Missing map[string]bool
+}
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{
+		Errors:  map[string]error{},
+		Outputs: map[string][]byte{},
+		Streams: map[string][]string{},
+		Missing: map[string]bool{},
+	}
+}
+
+// Run records the command and returns its scripted error
+func (r *Recorder) Run(cmd Cmd) error {
+	_, err := r.Output(cmd)
+	return err
+}
+
+// Output records the command and returns its scripted output and error
+func (r *Recorder) Output(cmd Cmd) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, cmd)
+	line := strings.Join(cmd.Argv(), " ")
+
+	output, ok := r.Outputs[line]
+	if !ok {
+		output = r.Outputs[cmd.Name]
+	}
+	err, ok := r.Errors[line]
+	if !ok {
+		err = r.Errors[cmd.Name]
+	}
+	return output, err
+}
+
+// Stream records the command, calls line for each of its scripted lines and
+// returns its scripted error without waiting for stop
+func (r *Recorder) Stream(cmd Cmd, line func(string), stop <-chan struct{}) error {
+	r.mu.Lock()
+	r.calls = append(r.calls, cmd)
+	key := strings.Join(cmd.Argv(), " ")
+	lines, ok := r.Streams[key]
+	if !ok {
+		lines = r.Streams[cmd.Name]
+	}
+	err, ok := r.Errors[key]
+	if !ok {
+		err = r.Errors[cmd.Name]
+	}
+	r.mu.Unlock()
+
+	for _, l := range lines {
+		line(l)
+	}
+	return err
+}
+
+// LookPath reports programs listed in Missing as not installed
+func (r *Recorder) LookPath(name string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.Missing[name] {
+		return "", fmt.Errorf("%s: executable file not found in $PATH", name)
+	}
+	return "/usr/bin/" + name, nil
+}
+
+// Calls returns every command recorded so far
+func (r *Recorder) Calls() []Cmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := make([]Cmd, len(r.calls))
+	copy(calls, r.calls)
+	return calls
+}
+
+// Lines returns every recorded command as a space-separated command line
+func (r *Recorder) Lines() []string {
+	var lines []string
+	for _, cmd := range r.Calls() {
+		lines = append(lines, strings.Join(cmd.Argv(), " "))
+	}
+	return lines
+}
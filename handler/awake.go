@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/executor"
+	"github.com/timmo001/go-commands/logind"
+)
+
+// KeepAwake stops the machine going idle or to sleep while it is on
+type KeepAwake struct {
+	mu      sync.Mutex
+	mode    string
+	timeout time.Duration
+	// release drops the inhibitor, and is nil while off
+	release func() error
+	until   time.Time
+	timer   *time.Timer
+	// holding counts how often the inhibitor has been taken, so a timeout or
+	// exit from an earlier hold does not turn off a newer one
+	holding int
+
+	// Notifier reports when the inhibitor is taken or dropped
+	entity.Notifier
+}
+
+// keepAwake is the inhibitor behind the Keep Awake switch
+var keepAwake = NewKeepAwake(config.KeepAwakeConfig{Mode: config.KeepAwakeBoth})
+
+func init() {
+	entity.Register("keep_awake", GetKeepAwakeEntities)
+}
+
+// NewKeepAwake creates a KeepAwake that is off
+func NewKeepAwake(cfg config.KeepAwakeConfig) *KeepAwake {
+	return &KeepAwake{mode: cfg.Mode, timeout: cfg.Timeout}
+}
+
+// ConfigureKeepAwake sets what the Keep Awake switch stops and how long it
+// stays on. It is called at startup, before the switch can be turned on.
+func ConfigureKeepAwake(cfg config.KeepAwakeConfig) {
+	keepAwake.mu.Lock()
+	defer keepAwake.mu.Unlock()
+
+	keepAwake.mode = cfg.Mode
+	keepAwake.timeout = cfg.Timeout
+}
+
+// ReleaseKeepAwake turns the Keep Awake switch off, e.g. before exiting
+func ReleaseKeepAwake() {
+	if err := keepAwake.Off(); err != nil {
+		log.Error("Failed to release keep awake", "error", err)
+	}
+}
+
+// On takes the inhibitor, or restarts the timeout if it is already held
+func (k *KeepAwake) On() error {
+	k.mu.Lock()
+	if k.release == nil {
+		k.holding++
+		release, err := k.inhibit(k.holding)
+		if err != nil {
+			k.mu.Unlock()
+			return err
+		}
+		k.release = release
+		log.Info("Keeping the system awake", "mode", k.mode, "timeout", k.timeout)
+	}
+
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+	k.until = time.Time{}
+	if k.timeout > 0 {
+		holding := k.holding
+		k.until = time.Now().Add(k.timeout)
+		k.timer = time.AfterFunc(k.timeout, func() { k.expire(holding) })
+	}
+	k.mu.Unlock()
+
+	k.Notify()
+	return nil
+}
+
+// Off drops the inhibitor if it is held
+func (k *KeepAwake) Off() error {
+	k.mu.Lock()
+	err := k.drop()
+	k.mu.Unlock()
+
+	k.Notify()
+	return err
+}
+
+// Active reports whether the inhibitor is held
+func (k *KeepAwake) Active() bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.release != nil
+}
+
+// attributes returns what is inhibited and when the switch turns itself off
+func (k *KeepAwake) attributes() map[string]any {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	attributes := map[string]any{"mode": k.mode, "until": nil}
+	if k.release != nil && !k.until.IsZero() {
+		attributes["until"] = k.until.Format(time.RFC3339)
+	}
+	return attributes
+}
+
+// drop releases the inhibitor. k.mu must be held.
+func (k *KeepAwake) drop() error {
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+	if k.release == nil {
+		return nil
+	}
+
+	release := k.release
+	k.release = nil
+	log.Info("No longer keeping the system awake")
+	return release()
+}
+
+// expire turns the switch off once the timeout has passed
+func (k *KeepAwake) expire(holding int) {
+	k.mu.Lock()
+	if holding != k.holding {
+		k.mu.Unlock()
+		return
+	}
+	err := k.drop()
+	k.mu.Unlock()
+
+	if err != nil {
+		log.Error("Failed to release keep awake", "error", err)
+	}
+	k.Notify()
+}
+
+// lost marks the inhibitor as dropped when it ends without being released,
+// e.g. when caffeinate is killed
+func (k *KeepAwake) lost(holding int, err error) {
+	k.mu.Lock()
+	if holding != k.holding || k.release == nil {
+		k.mu.Unlock()
+		return
+	}
+	k.release = nil
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+	k.mu.Unlock()
+
+	log.Warn("Keep awake ended unexpectedly", "error", err)
+	k.Notify()
+}
+
+// inhibit takes the platform's inhibitor and returns a function releasing it. k.mu must be held.
+func (k *KeepAwake) inhibit(holding int) (func() error, error) {
+	switch goos {
+	case "linux":
+		manager := login()
+		if manager == nil {
+			return nil, fmt.Errorf("keep awake needs systemd-logind")
+		}
+		what := map[string]string{
+			config.KeepAwakeIdle:  logind.InhibitIdle,
+			config.KeepAwakeSleep: logind.InhibitSleep,
+			config.KeepAwakeBoth:  logind.InhibitIdle + ":" + logind.InhibitSleep,
+		}[k.mode]
+		inhibitor, err := manager.Inhibit(what, "Go Commands", "Keep Awake is on in Home Assistant")
+		if err != nil {
+			return nil, err
+		}
+		return inhibitor.Close, nil
+	case "darwin":
+		// -d stops the display sleeping and -i stops idle sleep. -w ends
+		// caffeinate if this process exits without releasing it.
+		flags := map[string]string{
+			config.KeepAwakeIdle:  "-d",
+			config.KeepAwakeSleep: "-i",
+			config.KeepAwakeBoth:  "-di",
+		}[k.mode]
+		stop := make(chan struct{})
+		go func() {
+			err := execer.Stream(executor.Command("caffeinate", flags, "-w", strconv.Itoa(os.Getpid())), func(string) {}, stop)
+			k.lost(holding, err)
+		}()
+		return func() error {
+			close(stop)
+			return nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("keep awake not supported on %s", goos)
+	}
+}
+
+// probeKeepAwake checks that the system can be kept awake
+func probeKeepAwake() error {
+	switch goos {
+	case "linux":
+		if login() == nil {
+			return fmt.Errorf("keep awake needs systemd-logind")
+		}
+		return nil
+	case "darwin":
+		return lookPath("caffeinate")
+	default:
+		return fmt.Errorf("keep awake not supported on %s", goos)
+	}
+}
+
+// GetKeepAwakeEntities returns the Keep Awake switch
+func GetKeepAwakeEntities() []entity.Entity {
+	if err := probeKeepAwake(); err != nil {
+		log.Debug("Keep awake is not available", "reason", err)
+		return nil
+	}
+
+	return []entity.Entity{
+		{
+			Component: "switch",
+			ID:        "keep_awake",
+			Name:      "Keep Awake",
+			Icon:      "mdi:coffee",
+			State: func() (any, error) {
+				return entity.OnOff(keepAwake.Active()), nil
+			},
+			Attributes: func() (map[string]any, error) {
+				return keepAwake.attributes(), nil
+			},
+			Command: func(payload string) error {
+				switch payload {
+				case "ON":
+					return keepAwake.On()
+				case "OFF":
+					return keepAwake.Off()
+				default:
+					return fmt.Errorf("invalid keep awake state %q, expected ON or OFF", payload)
+				}
+			},
+			Watch: keepAwake.Watch,
+		},
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/config"
+)
+
+// waitInactive waits for the inhibitor to be dropped
+func waitInactive(t *testing.T, k *KeepAwake) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for k.Active() {
+		if time.Now().After(deadline) {
+			t.Fatal("keep awake is still on")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestKeepAwakeWithLogind(t *testing.T) {
+	fakeHost(t, "linux")
+	manager := fakeLogind(t)
+	k := NewKeepAwake(config.KeepAwakeConfig{Mode: config.KeepAwakeSleep})
+
+	if err := k.On(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Turning it on again keeps the same inhibitor
+	if err := k.On(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !k.Active() {
+		t.Fatal("expected keep awake to be on")
+	}
+	if calls := manager.Calls(); !slices.Equal(calls, []string{"Inhibit sleep block"}) {
+		t.Errorf("logind calls = %q", calls)
+	}
+
+	if err := k.Off(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if k.Active() {
+		t.Error("expected keep awake to be off")
+	}
+	if !manager.Released(0, 5*time.Second) {
+		t.Error("inhibitor was not released")
+	}
+}
+
+func TestKeepAwakeTimeout(t *testing.T) {
+	fakeHost(t, "linux")
+	manager := fakeLogind(t)
+	k := NewKeepAwake(config.KeepAwakeConfig{Mode: config.KeepAwakeBoth, Timeout: 50 * time.Millisecond})
+
+	if err := k.On(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if until := k.attributes()["until"]; until == nil {
+		t.Error("expected the time it turns off as an attribute")
+	}
+
+	waitInactive(t, k)
+	if calls := manager.Calls(); !slices.Equal(calls, []string{"Inhibit idle:sleep block"}) {
+		t.Errorf("logind calls = %q", calls)
+	}
+	if !manager.Released(0, 5*time.Second) {
+		t.Error("inhibitor was not released after the timeout")
+	}
+}
+
+func TestKeepAwakeOnDarwin(t *testing.T) {
+	recorder := fakeHost(t, "darwin")
+	k := NewKeepAwake(config.KeepAwakeConfig{Mode: config.KeepAwakeBoth})
+
+	// The recorded caffeinate exits straight away, which turns the switch off
+	if err := k.On(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitInactive(t, k)
+	assertLines(t, recorder, fmt.Sprintf("caffeinate -di -w %d", os.Getpid()))
+}
+
+func TestKeepAwakeUnsupported(t *testing.T) {
+	fakeHost(t, "linux")
+
+	if err := NewKeepAwake(config.KeepAwakeConfig{Mode: config.KeepAwakeBoth}).On(); err == nil {
+		t.Error("expected an error without logind")
+	}
+	if entities := GetKeepAwakeEntities(); len(entities) != 0 {
+		t.Errorf("got %d entities without logind, want none", len(entities))
+	}
+
+	fakeHost(t, "windows")
+	if entities := GetKeepAwakeEntities(); len(entities) != 0 {
+		t.Errorf("got %d entities on windows, want none", len(entities))
+	}
+}
+
+func TestKeepAwakeEntity(t *testing.T) {
+	fakeHost(t, "linux")
+	manager := fakeLogind(t)
+	previous := keepAwake
+	keepAwake = NewKeepAwake(config.KeepAwakeConfig{Mode: config.KeepAwakeBoth})
+	t.Cleanup(func() { keepAwake = previous })
+
+	entities := GetKeepAwakeEntities()
+	if len(entities) != 1 {
+		t.Fatalf("got %d entities, want 1", len(entities))
+	}
+	e := entities[0]
+
+	if err := e.Command("ON"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := e.State(); got != "ON" {
+		t.Errorf("state = %v, want ON", got)
+	}
+
+	// Exiting releases the inhibitor
+	ReleaseKeepAwake()
+	if got, _ := e.State(); got != "OFF" {
+		t.Errorf("state = %v, want OFF", got)
+	}
+	if !manager.Released(0, 5*time.Second) {
+		t.Error("inhibitor was not released")
+	}
+	if err := e.Command("SOMETIMES"); err == nil {
+		t.Error("expected an error for an invalid state")
+	}
+}
@@ -0,0 +1,329 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/executor"
+)
+
+const (
+	// clipboardPollInterval is how often the clipboard is read for changes
+	clipboardPollInterval = 2 * time.Second
+	// maxStateLength is the longest state Home Assistant accepts
+	maxStateLength = 255
+	// redacted replaces hidden parts of the clipboard
+	redacted = "[redacted]"
+	// passwordManagerHint is the clipboard type password managers add to secrets
+	passwordManagerHint = "x-kde-passwordManagerHint"
+	// getClipboardScript writes the Windows clipboard to stdout as UTF-8
+	getClipboardScript = "[Console]::OutputEncoding = [Text.Encoding]::UTF8; Get-Clipboard -Raw"
+	// setClipboardScript sets the Windows clipboard to the UTF-8 text on stdin,
+	// clearing it if there is none
+	setClipboardScript = "[Console]::InputEncoding = [Text.Encoding]::UTF8; $text = [Console]::In.ReadToEnd(); " +
+		"if ($text) { Set-Clipboard -Value $text } else { Set-Clipboard -Value $null }"
+)
+
+// clipboardSettings are the clipboard settings from the config file
+type clipboardSettings struct {
+	sensor        bool
+	maxSize       int
+	redact        []*regexp.Regexp
+	redactSecrets bool
+}
+
+// clipboardContent is the clipboard as published by the sensor
+type clipboardContent struct {
+	// text is the redacted contents, cut to the maximum size
+	text string
+	// length is the length of the full contents in characters
+	length int
+	// truncated is whether the contents were longer than the maximum size
+	truncated bool
+	// redacted is whether any of the contents were hidden
+	redacted bool
+}
+
+var (
+	clipboardMu     sync.Mutex
+	clipboardConfig = clipboardSettings{maxSize: config.DefaultClipboardMaxSize, redactSecrets: true}
+	// clipboardLast is the content most recently read by the sensor
+	clipboardLast clipboardContent
+)
+
+func init() {
+	entity.Register("clipboard", GetClipboardEntities)
+}
+
+// ConfigureClipboard applies the clipboard settings from the config file
+func ConfigureClipboard(cfg config.ClipboardConfig) error {
+	settings := clipboardSettings{
+		sensor:        cfg.Sensor,
+		maxSize:       cfg.MaxSize,
+		redactSecrets: cfg.RedactSecrets == nil || *cfg.RedactSecrets,
+	}
+	for _, pattern := range cfg.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redact pattern %q: %v", pattern, err)
+		}
+		settings.redact = append(settings.redact, re)
+	}
+
+	clipboardMu.Lock()
+	defer clipboardMu.Unlock()
+	clipboardConfig = settings
+	return nil
+}
+
+// clipboardSettingsNow returns the current clipboard settings
+func clipboardSettingsNow() clipboardSettings {
+	clipboardMu.Lock()
+	defer clipboardMu.Unlock()
+
+	return clipboardConfig
+}
+
+// wayland reports whether the session uses Wayland rather than X11
+func wayland() bool {
+	return getenv("WAYLAND_DISPLAY") != ""
+}
+
+// GetClipboard returns the text on the clipboard
+func GetClipboard() (string, error) {
+	switch goos {
+	case "windows":
+		// PowerShell writes in the OEM code page unless told otherwise
+		out, err := output("powershell", "-NoProfile", "-Command", getClipboardScript)
+		if err != nil {
+			return "", fmt.Errorf("failed to read clipboard: %v", err)
+		}
+		return strings.TrimSuffix(string(out), "\r\n"), nil
+	case "linux":
+		var out []byte
+		var err error
+		if wayland() {
+			out, err = output("wl-paste", "--no-newline")
+		} else {
+			out, err = output("xclip", "-selection", "clipboard", "-out")
+		}
+		if err != nil && !nothingCopied(err) {
+			return "", fmt.Errorf("failed to read clipboard: %v", err)
+		}
+		return string(out), nil
+	case "darwin":
+		out, err := output("pbpaste")
+		if err != nil {
+			return "", fmt.Errorf("failed to read clipboard: %v", err)
+		}
+		return string(out), nil
+	default:
+		return "", fmt.Errorf("clipboard not supported on %s", goos)
+	}
+}
+
+// nothingCopied reports whether reading the clipboard failed only because it
+// is empty, which wl-paste and xclip treat as an error
+func nothingCopied(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	// e.g. "Nothing is copied" from wl-paste, or "Error: target STRING not available" from xclip
+	stderr := string(exitErr.Stderr)
+	return strings.Contains(stderr, "Nothing is copied") || strings.Contains(stderr, "No selection") || strings.Contains(stderr, "not available")
+}
+
+// SetClipboard puts text on the clipboard. Empty text clears it.
+func SetClipboard(text string) error {
+	if maxSize := clipboardSettingsNow().maxSize; utf8.RuneCountInString(text) > maxSize {
+		return fmt.Errorf("text is longer than the maximum of %d characters", maxSize)
+	}
+
+	var cmd executor.Cmd
+	switch goos {
+	case "windows":
+		// clip reads stdin in the OEM code page, so read it as UTF-8 instead
+		cmd = executor.Command("powershell", "-NoProfile", "-Command", setClipboardScript)
+	case "linux":
+		if wayland() && text == "" {
+			cmd = executor.Command("wl-copy", "--clear")
+		} else if wayland() {
+			cmd = executor.Command("wl-copy")
+		} else {
+			cmd = executor.Command("xclip", "-selection", "clipboard", "-in")
+		}
+	case "darwin":
+		cmd = executor.Command("pbcopy")
+	default:
+		return fmt.Errorf("clipboard not supported on %s", goos)
+	}
+	cmd.Stdin = text
+	if err := execer.Run(cmd); err != nil {
+		return fmt.Errorf("failed to set clipboard: %v", err)
+	}
+	return nil
+}
+
+// clipboardSecret reports whether a password manager marked the clipboard as secret
+func clipboardSecret() bool {
+	if goos != "linux" {
+		return false
+	}
+
+	var out []byte
+	var err error
+	if wayland() {
+		out, err = output("wl-paste", "--list-types")
+	} else {
+		out, err = output("xclip", "-selection", "clipboard", "-out", "-target", "TARGETS")
+	}
+	return err == nil && strings.Contains(string(out), passwordManagerHint)
+}
+
+// readClipboard reads the clipboard for the sensor, hiding secrets and
+// matches of the redact patterns and cutting it to the maximum size
+func readClipboard() (clipboardContent, error) {
+	settings := clipboardSettingsNow()
+
+	text, err := GetClipboard()
+	if err != nil {
+		return clipboardContent{}, err
+	}
+	length := utf8.RuneCountInString(text)
+	content := clipboardContent{length: length, truncated: length > settings.maxSize}
+	if settings.redactSecrets && text != "" && clipboardSecret() {
+		return clipboardContent{text: redacted, redacted: true}, nil
+	}
+
+	for _, re := range settings.redact {
+		if re.MatchString(text) {
+			text = re.ReplaceAllString(text, redacted)
+			content.redacted = true
+		}
+	}
+	content.text = truncate(text, settings.maxSize)
+	return content, nil
+}
+
+// refreshClipboard reads the clipboard, remembering it for the sensor's attributes
+func refreshClipboard() (clipboardContent, error) {
+	content, err := readClipboard()
+	if err != nil {
+		return content, err
+	}
+
+	clipboardMu.Lock()
+	clipboardLast = content
+	clipboardMu.Unlock()
+	return content, nil
+}
+
+// watchClipboard calls changed whenever the clipboard changes until stop is closed
+func watchClipboard(changed func(), stop <-chan struct{}) {
+	ticker := time.NewTicker(clipboardPollInterval)
+	defer ticker.Stop()
+
+	last, _ := readClipboard()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			content, err := readClipboard()
+			if err == nil && content != last {
+				last = content
+				changed()
+			}
+		}
+	}
+}
+
+// truncate cuts text to at most max characters
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max])
+}
+
+// probeClipboard checks that the clipboard can be read and set
+func probeClipboard() error {
+	switch goos {
+	case "windows":
+		return nil
+	case "linux":
+		if wayland() {
+			if err := lookPath("wl-paste"); err != nil {
+				return err
+			}
+			return lookPath("wl-copy")
+		}
+		if getenv("DISPLAY") == "" {
+			return fmt.Errorf("no Wayland or X11 display")
+		}
+		return lookPath("xclip")
+	case "darwin":
+		return lookPath("pbcopy")
+	default:
+		return fmt.Errorf("clipboard not supported on %s", goos)
+	}
+}
+
+// GetClipboardEntities returns a text entity that sets the clipboard and,
+// when enabled in the config file, a sensor with its contents
+func GetClipboardEntities() []entity.Entity {
+	if probeClipboard() != nil {
+		return nil
+	}
+	settings := clipboardSettingsNow()
+
+	entities := []entity.Entity{
+		{
+			Component: "text",
+			ID:        "clipboard",
+			Name:      "Clipboard",
+			Icon:      "mdi:clipboard-text",
+			Config:    map[string]any{"max": min(settings.maxSize, maxStateLength)},
+			Command:   SetClipboard,
+		},
+	}
+	if settings.sensor {
+		entities = append(entities, entity.Entity{
+			Component: "sensor",
+			ID:        "clipboard",
+			Name:      "Clipboard Contents",
+			Icon:      "mdi:clipboard-text-search",
+			State: func() (any, error) {
+				content, err := refreshClipboard()
+				if err != nil {
+					return nil, err
+				}
+				return truncate(content.text, maxStateLength), nil
+			},
+			Attributes: func() (map[string]any, error) {
+				clipboardMu.Lock()
+				defer clipboardMu.Unlock()
+				attributes := map[string]any{
+					"text":      clipboardLast.text,
+					"truncated": clipboardLast.truncated,
+				}
+				// The length would give away what was redacted, such as a password's length
+				if !clipboardLast.redacted {
+					attributes["length"] = clipboardLast.length
+				}
+				return attributes, nil
+			},
+			Watch: watchClipboard,
+		})
+	}
+	return entities
+}
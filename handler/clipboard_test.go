@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/timmo001/go-commands/config"
+)
+
+// fakeClipboard applies clipboard settings and a display for the duration of a test
+func fakeClipboard(t *testing.T, cfg config.ClipboardConfig, env map[string]string) {
+	t.Helper()
+
+	previous := clipboardSettingsNow()
+	if cfg.MaxSize == 0 {
+		cfg.MaxSize = config.DefaultClipboardMaxSize
+	}
+	if err := ConfigureClipboard(cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	getenv = func(key string) string { return env[key] }
+	t.Cleanup(func() {
+		clipboardMu.Lock()
+		clipboardConfig, clipboardLast = previous, clipboardContent{}
+		clipboardMu.Unlock()
+	})
+}
+
+func TestGetClipboardPerOS(t *testing.T) {
+	tests := []struct {
+		os   string
+		env  map[string]string
+		out  string
+		want string
+		line string
+	}{
+		{"linux", map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, "copied", "copied", "wl-paste --no-newline"},
+		{"linux", map[string]string{"DISPLAY": ":0"}, "copied", "copied", "xclip -selection clipboard -out"},
+		{"darwin", nil, "copied", "copied", "pbpaste"},
+		{"windows", nil, "Grüße\r\n", "Grüße", "powershell -NoProfile -Command " + getClipboardScript},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			recorder := fakeHost(t, tt.os)
+			fakeClipboard(t, config.ClipboardConfig{}, tt.env)
+			recorder.Outputs[tt.line] = []byte(tt.out)
+
+			got, err := GetClipboard()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("clipboard = %q, want %q", got, tt.want)
+			}
+			assertLines(t, recorder, tt.line)
+		})
+	}
+}
+
+func TestGetEmptyClipboard(t *testing.T) {
+	tests := map[string]struct {
+		env    map[string]string
+		line   string
+		stderr string
+	}{
+		"wayland": {map[string]string{"WAYLAND_DISPLAY": "wayland-0"}, "wl-paste --no-newline", "Nothing is copied\n"},
+		"x11":     {map[string]string{"DISPLAY": ":0"}, "xclip -selection clipboard -out", "Error: target STRING not available\n"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := fakeHost(t, "linux")
+			fakeClipboard(t, config.ClipboardConfig{}, tt.env)
+			recorder.Errors[tt.line] = &exec.ExitError{Stderr: []byte(tt.stderr)}
+
+			if got, err := GetClipboard(); err != nil || got != "" {
+				t.Errorf("clipboard = %q, %v, want it empty", got, err)
+			}
+
+			recorder.Errors[tt.line] = &exec.ExitError{Stderr: []byte("Failed to connect to a Wayland server\n")}
+			if _, err := GetClipboard(); err == nil {
+				t.Error("expected an error when the display cannot be reached")
+			}
+		})
+	}
+}
+
+func TestSetClipboard(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	fakeClipboard(t, config.ClipboardConfig{MaxSize: 10}, map[string]string{"WAYLAND_DISPLAY": "wayland-0"})
+
+	if err := SetClipboard("hello"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := SetClipboard("more than ten characters"); err == nil {
+		t.Error("SetClipboard succeeded with text over the maximum size")
+	}
+
+	if err := SetClipboard(""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := recorder.Calls()
+	if len(calls) != 2 || calls[0].Name != "wl-copy" || calls[0].Stdin != "hello" {
+		t.Errorf("calls = %+v, want wl-copy with hello on stdin", calls)
+	}
+	assertLines(t, recorder, "wl-copy", "wl-copy --clear")
+}
+
+func TestSetClipboardWindows(t *testing.T) {
+	recorder := fakeHost(t, "windows")
+	fakeClipboard(t, config.ClipboardConfig{}, nil)
+
+	if err := SetClipboard("Grüße"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calls := recorder.Calls()
+	if len(calls) != 1 || calls[0].Name != "powershell" || calls[0].Args[len(calls[0].Args)-1] != setClipboardScript || calls[0].Stdin != "Grüße" {
+		t.Errorf("calls = %+v, want Set-Clipboard with the text on stdin", calls)
+	}
+}
+
+func TestReadClipboardRedacts(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	fakeClipboard(t, config.ClipboardConfig{MaxSize: 20, Redact: []string{`\d{4}-\d{4}`}}, map[string]string{"DISPLAY": ":0"})
+	recorder.Outputs["xclip -selection clipboard -out"] = []byte("card 1234-5678 and a long tail")
+
+	content, err := readClipboard()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := clipboardContent{text: "card [redacted] and ", length: 30, truncated: true, redacted: true}
+	if content != want {
+		t.Errorf("content = %+v, want %+v", content, want)
+	}
+
+	// Redacting alone does not make the contents truncated
+	recorder.Outputs["xclip -selection clipboard -out"] = []byte("1234-5678")
+	want = clipboardContent{text: "[redacted]", length: 9, redacted: true}
+	if content, _ := readClipboard(); content != want {
+		t.Errorf("content = %+v, want %+v", content, want)
+	}
+
+	recorder.Outputs["xclip -selection clipboard -out"] = []byte("card 1234-5678 and a long tail")
+	recorder.Outputs["xclip -selection clipboard -out -target TARGETS"] = []byte("TARGETS\nUTF8_STRING\nx-kde-passwordManagerHint\n")
+	if content, _ := readClipboard(); content != (clipboardContent{text: redacted, redacted: true}) {
+		t.Errorf("secret content = %+v, want it redacted without its length", content)
+	}
+
+	secrets := false
+	fakeClipboard(t, config.ClipboardConfig{RedactSecrets: &secrets}, map[string]string{"DISPLAY": ":0"})
+	if content, _ := readClipboard(); content.text != "card 1234-5678 and a long tail" {
+		t.Errorf("content = %q, want secrets shown when redaction is off", content.text)
+	}
+}
+
+func TestConfigureClipboardRejectsInvalidPattern(t *testing.T) {
+	fakeHost(t, "linux")
+	fakeClipboard(t, config.ClipboardConfig{}, nil)
+
+	if err := ConfigureClipboard(config.ClipboardConfig{MaxSize: 10, Redact: []string{"("}}); err == nil {
+		t.Error("ConfigureClipboard succeeded with an invalid pattern")
+	}
+}
+
+func TestGetClipboardEntities(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	if got := GetClipboardEntities(); len(got) != 0 {
+		t.Errorf("got %d entities without a display, want none", len(got))
+	}
+
+	fakeClipboard(t, config.ClipboardConfig{MaxSize: 1000}, map[string]string{"WAYLAND_DISPLAY": "wayland-0"})
+	entities := GetClipboardEntities()
+	if len(entities) != 1 || entities[0].Component != "text" || entities[0].Config["max"] != maxStateLength {
+		t.Fatalf("unexpected entities with the sensor off: %+v", entities)
+	}
+
+	fakeClipboard(t, config.ClipboardConfig{Sensor: true, MaxSize: 1000}, map[string]string{"WAYLAND_DISPLAY": "wayland-0"})
+	recorder.Outputs["wl-paste --no-newline"] = []byte(strings.Repeat("a", 300))
+	entities = GetClipboardEntities()
+	if len(entities) != 2 || entities[1].Component != "sensor" {
+		t.Fatalf("unexpected entities with the sensor on: %+v", entities)
+	}
+
+	state, err := entities[1].State()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state != strings.Repeat("a", maxStateLength) {
+		t.Errorf("state has %d characters, want %d", len(state.(string)), maxStateLength)
+	}
+	attributes, _ := entities[1].Attributes()
+	want := map[string]any{"text": strings.Repeat("a", 300), "length": 300, "truncated": false}
+	if !reflect.DeepEqual(attributes, want) {
+		t.Errorf("attributes = %v, want %v", attributes, want)
+	}
+
+	recorder.Outputs["wl-paste --list-types"] = []byte("text/plain\nx-kde-passwordManagerHint\n")
+	entities[1].State()
+	attributes, _ = entities[1].Attributes()
+	want = map[string]any{"text": redacted, "truncated": false}
+	if !reflect.DeepEqual(attributes, want) {
+		t.Errorf("secret attributes = %v, want %v", attributes, want)
+	}
+
+	recorder.Missing["wl-copy"] = true
+	if got := GetClipboardEntities(); len(got) != 0 {
+		t.Errorf("got %d entities without wl-copy, want none", len(got))
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/timmo001/go-commands/config"
+)
+
+// Command represents a command that can be triggered from Home Assistant
+type Command interface {
+	Name() string
+	Icon() string
+	Description() string
+	Execute() error
+}
+
+// Prober is implemented by commands that can check whether they work on this machine
+type Prober interface {
+	// Probe returns an error describing why the command cannot run here
+	Probe() error
+}
+
+// Probe checks whether a command can run on this machine. Commands without a
+// probe are assumed to work.
+func Probe(cmd Command) error {
+	if prober, ok := cmd.(Prober); ok {
+		return prober.Probe()
+	}
+	return nil
+}
+
+// command is the default Command implementation backed by a handler function
+type command struct {
+	name        string
+	icon        string
+	description string
+	handler     func() error
+	probe       func() error
+}
+
+// NewCommand creates a Command from its metadata and handler function
+func NewCommand(name, icon, description string, handler func() error) Command {
+	return &command{
+		name:        name,
+		icon:        icon,
+		description: description,
+		handler:     handler,
+	}
+}
+
+// NewProbedCommand creates a Command with a probe that checks whether it can
+// run on this machine
+func NewProbedCommand(name, icon, description string, handler, probe func() error) Command {
+	return &command{
+		name:        name,
+		icon:        icon,
+		description: description,
+		handler:     handler,
+		probe:       probe,
+	}
+}
+
+func (c *command) Name() string        { return c.name }
+func (c *command) Icon() string        { return c.icon }
+func (c *command) Description() string { return c.description }
+func (c *command) Execute() error      { return c.handler() }
+
+func (c *command) Probe() error {
+	if c.probe == nil {
+		return nil
+	}
+	return c.probe()
+}
+
+// CommandID returns the topic-safe identifier for a command name
+func CommandID(name string) string {
+	return config.CommandID(name)
+}
+
+// GetButtonConfig returns the Home Assistant button configuration for a command in a category
+func GetButtonConfig(device map[string]any, uniqueID string, baseTopic string, category string, cmd Command) (string, map[string]any) {
+	nameAsId := CommandID(cmd.Name())
+	return nameAsId, map[string]any{
+		"name":               cmd.Name(),
+		"unique_id":          fmt.Sprintf("%s_%s_%s", uniqueID, category, nameAsId),
+		"command_topic":      CommandTopic(baseTopic, category, nameAsId),
+		"availability_topic": fmt.Sprintf("%s/availability", baseTopic),
+		"icon":               cmd.Icon(),
+		"device":             device,
+	}
+}
+
+// CommandTopic returns the MQTT topic a command listens on
+func CommandTopic(baseTopic, category, nameAsId string) string {
+	return fmt.Sprintf("%s/%s/%s", baseTopic, category, nameAsId)
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/timmo001/go-commands/entity"
+)
+
+// Confirmation arms a command on the first press, so it only runs when
+// pressed again within a window
+type Confirmation struct {
+	// Window is how long the command stays armed
+	Window time.Duration
+
+	mu    sync.Mutex
+	armed bool
+	timer *time.Timer
+	// arming counts how often the command has been armed, so a window that
+	// expires just as the command is armed again does not disarm it
+	arming int
+
+	// Notifier reports when the command is armed or disarmed
+	entity.Notifier
+}
+
+var (
+	confirmationsMu sync.RWMutex
+	confirmations   = map[string]*Confirmation{}
+)
+
+func init() {
+	entity.Register("confirmation", GetConfirmationEntities)
+}
+
+// RequireConfirmation makes a command only run when pressed twice within a
+// window. It returns an error if no such command is registered, though the
+// confirmation still applies if the command is registered later.
+func RequireConfirmation(category, commandID string, window time.Duration) error {
+	confirmationsMu.Lock()
+	confirmations[category+"/"+commandID] = &Confirmation{Window: window}
+	confirmationsMu.Unlock()
+
+	if _, ok := findCommand(category, commandID); !ok {
+		return fmt.Errorf("no command %s/%s", category, commandID)
+	}
+	return nil
+}
+
+// ConfirmationFor returns the confirmation a command requires, or nil
+func ConfirmationFor(category, commandID string) *Confirmation {
+	confirmationsMu.RLock()
+	defer confirmationsMu.RUnlock()
+
+	return confirmations[category+"/"+commandID]
+}
+
+// Press arms the command, or disarms it and returns true if it was already
+// armed and should run
+func (c *Confirmation) Press() bool {
+	c.mu.Lock()
+	if c.armed {
+		c.armed = false
+		c.timer.Stop()
+		c.mu.Unlock()
+		c.Notify()
+		return true
+	}
+
+	c.armed = true
+	c.arming++
+	arming := c.arming
+	c.timer = time.AfterFunc(c.Window, func() { c.expire(arming) })
+	c.mu.Unlock()
+	c.Notify()
+	return false
+}
+
+// Armed reports whether the next press runs the command
+func (c *Confirmation) Armed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.armed
+}
+
+// expire ends the window without running the command
+func (c *Confirmation) expire(arming int) {
+	c.mu.Lock()
+	if !c.armed || arming != c.arming {
+		c.mu.Unlock()
+		return
+	}
+	c.armed = false
+	c.mu.Unlock()
+	c.Notify()
+}
+
+// GetConfirmationEntities returns a binary sensor showing when each command
+// that requires confirmation is armed. Commands that cannot run on this
+// machine are left out, as they can never be armed.
+func GetConfirmationEntities() []entity.Entity {
+	var entities []entity.Entity
+	for _, category := range Categories() {
+		for _, cmd := range category.Commands() {
+			nameAsId := CommandID(cmd.Name())
+			confirmation := ConfirmationFor(category.Name, nameAsId)
+			if confirmation == nil || Probe(cmd) != nil {
+				continue
+			}
+			entities = append(entities, entity.Entity{
+				Component: "binary_sensor",
+				ID:        fmt.Sprintf("%s_%s_armed", category.Name, nameAsId),
+				Name:      cmd.Name() + " Armed",
+				Icon:      "mdi:shield-alert",
+				State: func() (any, error) {
+					return entity.OnOff(confirmation.Armed()), nil
+				},
+				Watch: confirmation.Watch,
+			})
+		}
+	}
+	return entities
+}
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfirmationPress(t *testing.T) {
+	c := &Confirmation{Window: time.Hour}
+
+	changes := make(chan struct{}, 4)
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.Watch(func() { changes <- struct{}{} }, stop)
+	// Wait for the watcher to be registered
+	for c.Watching() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if c.Press() {
+		t.Fatal("first press should only arm the command")
+	}
+	if !c.Armed() {
+		t.Error("expected the command to be armed")
+	}
+	if !c.Press() {
+		t.Fatal("second press should run the command")
+	}
+	if c.Armed() {
+		t.Error("expected the command to be disarmed after running")
+	}
+	if len(changes) != 2 {
+		t.Errorf("got %d state changes, want 2", len(changes))
+	}
+}
+
+func TestConfirmationExpires(t *testing.T) {
+	c := &Confirmation{Window: 20 * time.Millisecond}
+
+	if c.Press() {
+		t.Fatal("first press should only arm the command")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if c.Armed() {
+		t.Fatal("expected the window to expire")
+	}
+
+	// After the window the next press arms again rather than running
+	if c.Press() {
+		t.Error("press after the window should only arm the command")
+	}
+}
+
+func TestRequireConfirmation(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	t.Cleanup(func() {
+		confirmationsMu.Lock()
+		confirmations = map[string]*Confirmation{}
+		confirmationsMu.Unlock()
+	})
+
+	if err := RequireConfirmation("power", "shutdown", time.Minute); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := RequireConfirmation("power", "shutdwon", time.Minute); err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+	if ConfirmationFor("power", "shutdown") == nil || ConfirmationFor("power", "restart") != nil {
+		t.Error("confirmation registered for the wrong commands")
+	}
+
+	entities := GetConfirmationEntities()
+	if len(entities) != 1 {
+		t.Fatalf("got %d armed sensors, want 1", len(entities))
+	}
+	if e := entities[0]; e.ID != "power_shutdown_armed" || e.Name != "Shutdown Armed" {
+		t.Errorf("unexpected entity %s %q", e.ID, e.Name)
+	}
+	if state, _ := entities[0].State(); state != "OFF" {
+		t.Errorf("state = %v, want OFF", state)
+	}
+
+	// No sensor for a command that is hidden as unsupported
+	recorder.Missing["shutdown"] = true
+	if entities := GetConfirmationEntities(); len(entities) != 0 {
+		t.Errorf("got %d armed sensors for an unsupported command, want none", len(entities))
+	}
+}
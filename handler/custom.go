@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/executor"
+)
+
+// defaultCustomIcon is used for custom commands that do not set an icon
+const defaultCustomIcon = "mdi:console"
+
+// RegisterCustomCommands registers the user-defined commands from the config file
+func RegisterCustomCommands(configs []config.CommandConfig) {
+	commands := make([]Command, 0, len(configs))
+	for _, cfg := range configs {
+		commands = append(commands, newCustomCommand(cfg))
+	}
+
+	Register("custom", func() []Command {
+		return commands
+	})
+}
+
+// newCustomCommand creates a Command that runs the configured argv
+func newCustomCommand(cfg config.CommandConfig) Command {
+	icon := cfg.Icon
+	if icon == "" {
+		icon = defaultCustomIcon
+	}
+
+	env := make([]string, 0, len(cfg.Env))
+	for key, value := range cfg.Env {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(env)
+
+	cmd := executor.Cmd{
+		Name:    cfg.Command[0],
+		Args:    cfg.Command[1:],
+		Dir:     cfg.WorkingDir,
+		Env:     env,
+		Timeout: cfg.Timeout,
+	}
+
+	return NewProbedCommand(cfg.Name, icon, cfg.Description, func() error {
+		return execer.Run(cmd)
+	}, func() error {
+		// Programs given as a relative path are run from the working directory
+		program := cmd.Name
+		if strings.ContainsRune(program, filepath.Separator) && !filepath.IsAbs(program) && cmd.Dir != "" {
+			program = filepath.Join(cmd.Dir, program)
+		}
+		return lookPath(program)
+	})
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/executor"
+)
+
+func TestCustomCommand(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+
+	cmd := newCustomCommand(config.CommandConfig{
+		Name:       "Backup",
+		Command:    []string{"./backup.sh", "--all"},
+		WorkingDir: "/srv/scripts",
+		Env:        map[string]string{"TARGET": "/mnt/backup", "MODE": "full"},
+		Timeout:    time.Minute,
+	})
+
+	if cmd.Icon() != defaultCustomIcon {
+		t.Errorf("icon = %q, want %q", cmd.Icon(), defaultCustomIcon)
+	}
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []executor.Cmd{{
+		Name:    "./backup.sh",
+		Args:    []string{"--all"},
+		Dir:     "/srv/scripts",
+		Env:     []string{"MODE=full", "TARGET=/mnt/backup"},
+		Timeout: time.Minute,
+	}}
+	if got := recorder.Calls(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %+v, want %+v", got, want)
+	}
+}
+
+func TestRegisterCustomCommands(t *testing.T) {
+	RegisterCustomCommands([]config.CommandConfig{
+		{Name: "Backup", Icon: "mdi:backup-restore", Command: []string{"backup"}},
+	})
+
+	var custom *Category
+	for _, category := range Categories() {
+		if category.Name == "custom" {
+			custom = &category
+		}
+	}
+	if custom == nil {
+		t.Fatal("custom category was not registered")
+	}
+
+	commands := custom.Commands()
+	if len(commands) != 1 || commands[0].Name() != "Backup" {
+		t.Fatalf("unexpected commands: %v", commands)
+	}
+
+	id, buttonConfig := GetButtonConfig(map[string]any{}, "go_commands_host", "go-commands/go_commands_host", custom.Name, commands[0])
+	if id != "backup" {
+		t.Errorf("id = %q, want backup", id)
+	}
+	if buttonConfig["command_topic"] != "go-commands/go_commands_host/custom/backup" {
+		t.Errorf("command_topic = %v", buttonConfig["command_topic"])
+	}
+	if buttonConfig["unique_id"] != "go_commands_host_custom_backup" {
+		t.Errorf("unique_id = %v", buttonConfig["unique_id"])
+	}
+}
+
+func TestCustomCommandProbe(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Missing["missing-tool"] = true
+	recorder.Missing["/srv/scripts/backup.sh"] = true
+
+	tests := map[string]struct {
+		cfg  config.CommandConfig
+		want bool
+	}{
+		"installed":     {config.CommandConfig{Name: "A", Command: []string{"rsync"}}, true},
+		"missing":       {config.CommandConfig{Name: "B", Command: []string{"missing-tool"}}, false},
+		"relative path": {config.CommandConfig{Name: "C", Command: []string{"./backup.sh"}, WorkingDir: "/srv/scripts"}, false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := Probe(newCustomCommand(tt.cfg))
+			if (err == nil) != tt.want {
+				t.Errorf("probe error = %v, want supported %t", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/timmo001/go-commands/executor"
+)
+
+var (
+	// execer runs the external processes behind each handler
+	execer executor.Executor = executor.System{}
+	// goos selects the platform specific branch of each handler
+	goos = runtime.GOOS
+	// getenv reads the environment, e.g. to find the display server
+	getenv = os.Getenv
+)
+
+// run runs a program with arguments through the configured executor
+func run(name string, args ...string) error {
+	return execer.Run(executor.Command(name, args...))
+}
+
+// output runs a program through the configured executor and returns its output
+func output(name string, args ...string) ([]byte, error) {
+	return execer.Output(executor.Command(name, args...))
+}
+
+// lookPath returns an error if a program is not installed
+func lookPath(name string) error {
+	if _, err := execer.LookPath(name); err != nil {
+		return fmt.Errorf("%s is not installed", name)
+	}
+	return nil
+}
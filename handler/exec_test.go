@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/timmo001/go-commands/executor"
+	"github.com/timmo001/go-commands/logind"
+	"github.com/timmo001/go-commands/mpris"
+	"github.com/timmo001/go-commands/notify"
+)
+
+// fakeHost swaps the executor and OS for the duration of a test. The host's
+// D-Bus services and environment are hidden so tests never control the real machine.
+func fakeHost(t *testing.T, os string) *executor.Recorder {
+	t.Helper()
+
+	recorder := executor.NewRecorder()
+	previousExecer, previousOS, previousGetenv := execer, goos, getenv
+	previousLogin, previousPlayers, previousNotifications := loginManager, mediaPlayers, notifications
+	execer, goos = recorder, os
+	getenv = func(string) string { return "" }
+	loginManager = func() (*logind.Client, error) { return nil, errors.New("no system bus in tests") }
+	mediaPlayers = func() (*mpris.Client, error) { return nil, errors.New("no session bus in tests") }
+	notifications = func() (*notify.Client, error) { return nil, errors.New("no session bus in tests") }
+	t.Cleanup(func() {
+		execer, goos, getenv = previousExecer, previousOS, previousGetenv
+		loginManager, mediaPlayers, notifications = previousLogin, previousPlayers, previousNotifications
+	})
+	return recorder
+}
+
+// assertLines fails the test if the recorded command lines differ from want
+func assertLines(t *testing.T, recorder *executor.Recorder, want ...string) {
+	t.Helper()
+
+	if got := recorder.Lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
@@ -2,174 +2,182 @@ package handler
 
 import (
 	"fmt"
-	"os/exec"
-	"runtime"
-	"strings"
+	"sync"
+
+	"github.com/timmo001/go-commands/mpris"
+)
+
+var (
+	mprisMu     sync.Mutex
+	mprisClient *mpris.Client
 )
 
-// MediaCommand represents a media control command
-type MediaCommand struct {
-	Name        string
-	Icon        string
-	Description string
-	Handler     func() error
+// mediaPlayers returns the client for MPRIS players, connecting to the
+// session bus on first use
+var mediaPlayers = func() (*mpris.Client, error) {
+	mprisMu.Lock()
+	defer mprisMu.Unlock()
+
+	if mprisClient == nil {
+		client, err := mpris.Connect()
+		if err != nil {
+			return nil, err
+		}
+		mprisClient = client
+	}
+	return mprisClient, nil
+}
+
+func init() {
+	Register("media", GetMediaCommands)
 }
 
 // GetMediaCommands returns all available media control commands
-func GetMediaCommands() []MediaCommand {
-	return []MediaCommand{
-		{
-			Name:        "Play/Pause",
-			Icon:        "mdi:play-pause",
-			Description: "Toggle media playback",
-			Handler:     PlayPause,
-		},
-		{
-			Name:        "Next Track",
-			Icon:        "mdi:skip-next",
-			Description: "Play next track",
-			Handler:     NextTrack,
-		},
-		{
-			Name:        "Previous Track",
-			Icon:        "mdi:skip-previous",
-			Description: "Play previous track",
-			Handler:     PreviousTrack,
-		},
-		{
-			Name:        "Volume Up",
-			Icon:        "mdi:volume-plus",
-			Description: "Increase volume",
-			Handler:     VolumeUp,
-		},
-		{
-			Name:        "Volume Down",
-			Icon:        "mdi:volume-minus",
-			Description: "Decrease volume",
-			Handler:     VolumeDown,
-		},
-		{
-			Name:        "Mute",
-			Icon:        "mdi:volume-mute",
-			Description: "Toggle mute",
-			Handler:     ToggleMute,
-		},
+func GetMediaCommands() []Command {
+	commands := []Command{
+		NewProbedCommand("Play/Pause", "mdi:play-pause", "Toggle media playback", PlayPause, probeMedia),
+		NewProbedCommand("Next Track", "mdi:skip-next", "Play next track", NextTrack, probeMedia),
+		NewProbedCommand("Previous Track", "mdi:skip-previous", "Play previous track", PreviousTrack, probeMedia),
+		NewProbedCommand("Volume Up", "mdi:volume-plus", "Increase volume", VolumeUp, probeVolume),
+		NewProbedCommand("Volume Down", "mdi:volume-minus", "Decrease volume", VolumeDown, probeVolume),
+	}
+
+	// Where the mute state can be read it is published as a switch instead
+	if !volumeSupported() {
+		commands = append(commands, NewProbedCommand("Mute", "mdi:volume-mute", "Toggle mute", ToggleMute, probeVolume))
 	}
+
+	return commands
 }
 
-// GetMediaButtonConfig returns the Home Assistant button configuration for a media command
-func GetMediaButtonConfig(device map[string]any, uniqueID string, baseTopic string, cmd MediaCommand) (string, map[string]interface{}) {
-	nameAsId := strings.ReplaceAll(strings.ToLower(cmd.Name), " ", "_")
-	nameAsId = strings.ReplaceAll(nameAsId, "/", "_")
-	return nameAsId, map[string]any{
-		"name":               fmt.Sprintf("%s", cmd.Name),
-		"unique_id":          fmt.Sprintf("%s_media_%s", uniqueID, nameAsId),
-		"command_topic":      fmt.Sprintf("%s/media/%s", baseTopic, nameAsId),
-		"availability_topic": fmt.Sprintf("%s/availability", baseTopic),
-		"icon":               cmd.Icon,
-		"enabled_by_default": true, // Set to false to disable by default in Home Assistant
-		"device":             device,
+// probeMedia checks that media players can be controlled
+func probeMedia() error {
+	switch goos {
+	case "windows", "darwin":
+		return nil
+	case "linux":
+		_, err := mediaPlayers()
+		return err
+	default:
+		return fmt.Errorf("media control not supported on %s", goos)
+	}
+}
+
+// probeVolume checks that the volume can be controlled
+func probeVolume() error {
+	switch goos {
+	case "windows", "darwin":
+		return nil
+	case "linux":
+		if err := lookPath("pactl"); err != nil {
+			return err
+		}
+		if err := run("pactl", "info"); err != nil {
+			return fmt.Errorf("no sound server: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("volume control not supported on %s", goos)
 	}
 }
 
 // PlayPause toggles media playback
 func PlayPause() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]179)")
-		return cmd.Run()
+		return run("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]179)")
 	case "linux":
-		cmd := exec.Command("dbus-send", "--type=method_call", "--dest=org.mpris.MediaPlayer2.playerctld", "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player.PlayPause")
-		return cmd.Run()
+		return mediaCommand("PlayPause")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to key code 16 using {command down}")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to key code 16 using {command down}")
 	default:
-		return fmt.Errorf("media control not supported on %s", runtime.GOOS)
+		return fmt.Errorf("media control not supported on %s", goos)
 	}
 }
 
 // NextTrack plays the next track
 func NextTrack() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]176)")
-		return cmd.Run()
+		return run("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]176)")
 	case "linux":
-		cmd := exec.Command("dbus-send", "--type=method_call", "--dest=org.mpris.MediaPlayer2.playerctld", "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player.Next")
-		return cmd.Run()
+		return mediaCommand("Next")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to key code 17 using {command down}")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to key code 17 using {command down}")
 	default:
-		return fmt.Errorf("media control not supported on %s", runtime.GOOS)
+		return fmt.Errorf("media control not supported on %s", goos)
 	}
 }
 
 // PreviousTrack plays the previous track
 func PreviousTrack() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]177)")
-		return cmd.Run()
+		return run("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]177)")
 	case "linux":
-		cmd := exec.Command("dbus-send", "--type=method_call", "--dest=org.mpris.MediaPlayer2.playerctld", "/org/mpris/MediaPlayer2", "org.mpris.MediaPlayer2.Player.Previous")
-		return cmd.Run()
+		return mediaCommand("Previous")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to key code 16 using {command down}")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to key code 16 using {command down}")
 	default:
-		return fmt.Errorf("media control not supported on %s", runtime.GOOS)
+		return fmt.Errorf("media control not supported on %s", goos)
 	}
 }
 
 // VolumeUp increases the system volume
 func VolumeUp() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]175)")
-		return cmd.Run()
+		return run("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]175)")
 	case "linux":
-		cmd := exec.Command("pactl", "set-sink-volume", "@DEFAULT_SINK@", "+5%")
-		return cmd.Run()
+		return run("pactl", "set-sink-volume", "@DEFAULT_SINK@", "+5%")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "set volume output volume (output volume of (get volume settings) + 6)")
-		return cmd.Run()
+		return run("osascript", "-e", "set volume output volume (output volume of (get volume settings) + 6)")
 	default:
-		return fmt.Errorf("volume control not supported on %s", runtime.GOOS)
+		return fmt.Errorf("volume control not supported on %s", goos)
 	}
 }
 
 // VolumeDown decreases the system volume
 func VolumeDown() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]174)")
-		return cmd.Run()
+		return run("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]174)")
 	case "linux":
-		cmd := exec.Command("pactl", "set-sink-volume", "@DEFAULT_SINK@", "-5%")
-		return cmd.Run()
+		return run("pactl", "set-sink-volume", "@DEFAULT_SINK@", "-5%")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "set volume output volume (output volume of (get volume settings) - 6)")
-		return cmd.Run()
+		return run("osascript", "-e", "set volume output volume (output volume of (get volume settings) - 6)")
 	default:
-		return fmt.Errorf("volume control not supported on %s", runtime.GOOS)
+		return fmt.Errorf("volume control not supported on %s", goos)
 	}
 }
 
 // ToggleMute toggles system mute state
 func ToggleMute() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]173)")
-		return cmd.Run()
+		return run("powershell", "-Command", "(New-Object -ComObject WScript.Shell).SendKeys([char]173)")
 	case "linux":
-		cmd := exec.Command("pactl", "set-sink-mute", "@DEFAULT_SINK@", "toggle")
-		return cmd.Run()
+		return run("pactl", "set-sink-mute", "@DEFAULT_SINK@", "toggle")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "set volume with output muted (not output muted of (get volume settings))")
-		return cmd.Run()
+		return run("osascript", "-e", "set volume with output muted (not output muted of (get volume settings))")
 	default:
-		return fmt.Errorf("mute control not supported on %s", runtime.GOOS)
+		return fmt.Errorf("mute control not supported on %s", goos)
+	}
+}
+
+// mediaCommand calls a playback method on the active MPRIS player
+func mediaCommand(method string) error {
+	client, err := mediaPlayers()
+	if err != nil {
+		return err
+	}
+
+	player, err := client.ActivePlayer()
+	if err != nil {
+		return fmt.Errorf("failed to find media player: %v", err)
+	}
+	if player == "" {
+		return fmt.Errorf("no media players running")
 	}
+	return client.Call(player, method)
 }
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/timmo001/go-commands/mpris"
+	"github.com/timmo001/go-commands/mpris/mpristest"
+)
+
+func TestMediaCommandsPerOS(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func() error
+		want    map[string]string
+		// mpris marks handlers that use D-Bus rather than a command on Linux
+		mpris bool
+	}{
+		{
+			name:    "PlayPause",
+			handler: PlayPause,
+			mpris:   true,
+			want: map[string]string{
+				"windows": "powershell -Command (New-Object -ComObject WScript.Shell).SendKeys([char]179)",
+				"darwin":  `osascript -e tell application "System Events" to key code 16 using {command down}`,
+			},
+		},
+		{
+			name:    "NextTrack",
+			handler: NextTrack,
+			mpris:   true,
+			want: map[string]string{
+				"windows": "powershell -Command (New-Object -ComObject WScript.Shell).SendKeys([char]176)",
+				"darwin":  `osascript -e tell application "System Events" to key code 17 using {command down}`,
+			},
+		},
+		{
+			name:    "PreviousTrack",
+			handler: PreviousTrack,
+			mpris:   true,
+			want: map[string]string{
+				"windows": "powershell -Command (New-Object -ComObject WScript.Shell).SendKeys([char]177)",
+				"darwin":  `osascript -e tell application "System Events" to key code 16 using {command down}`,
+			},
+		},
+		{
+			name:    "VolumeUp",
+			handler: VolumeUp,
+			want: map[string]string{
+				"windows": "powershell -Command (New-Object -ComObject WScript.Shell).SendKeys([char]175)",
+				"linux":   "pactl set-sink-volume @DEFAULT_SINK@ +5%",
+				"darwin":  "osascript -e set volume output volume (output volume of (get volume settings) + 6)",
+			},
+		},
+		{
+			name:    "VolumeDown",
+			handler: VolumeDown,
+			want: map[string]string{
+				"windows": "powershell -Command (New-Object -ComObject WScript.Shell).SendKeys([char]174)",
+				"linux":   "pactl set-sink-volume @DEFAULT_SINK@ -5%",
+				"darwin":  "osascript -e set volume output volume (output volume of (get volume settings) - 6)",
+			},
+		},
+		{
+			name:    "ToggleMute",
+			handler: ToggleMute,
+			want: map[string]string{
+				"windows": "powershell -Command (New-Object -ComObject WScript.Shell).SendKeys([char]173)",
+				"linux":   "pactl set-sink-mute @DEFAULT_SINK@ toggle",
+				"darwin":  "osascript -e set volume with output muted (not output muted of (get volume settings))",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, os := range []string{"windows", "linux", "darwin", "freebsd"} {
+			if tt.mpris && os == "linux" {
+				continue
+			}
+			t.Run(tt.name+"/"+os, func(t *testing.T) {
+				recorder := fakeHost(t, os)
+
+				err := tt.handler()
+
+				want, supported := tt.want[os]
+				if !supported {
+					if err == nil {
+						t.Fatalf("expected an error on %s", os)
+					}
+					assertLines(t, recorder)
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assertLines(t, recorder, want)
+			})
+		}
+	}
+}
+
+// fakePlayers points media commands at MPRIS players on a private session bus
+func fakePlayers(t *testing.T) string {
+	t.Helper()
+
+	address := mpristest.NewBus(t)
+	client := mpris.NewClient(mpristest.Connect(t, address))
+
+	previous := mediaPlayers
+	mediaPlayers = func() (*mpris.Client, error) { return client, nil }
+	t.Cleanup(func() { mediaPlayers = previous })
+	return address
+}
+
+func TestMediaCommandsLinux(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	address := fakePlayers(t)
+
+	if err := PlayPause(); err == nil {
+		t.Error("expected an error without media players")
+	}
+
+	mpv := mpristest.NewPlayer(t, address, "mpv", "mpv")
+	spotify := mpristest.NewPlayer(t, address, "spotify", "Spotify")
+	spotify.Set("PlaybackStatus", "Playing")
+
+	for _, handler := range []func() error{PlayPause, NextTrack, PreviousTrack} {
+		if err := handler(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Commands go to the playing player over D-Bus without running anything
+	if calls := spotify.Calls(); !slices.Equal(calls, []string{"PlayPause", "Next", "Previous"}) {
+		t.Errorf("spotify calls = %v", calls)
+	}
+	if calls := mpv.Calls(); len(calls) != 0 {
+		t.Errorf("mpv calls = %v, want none", calls)
+	}
+	assertLines(t, recorder)
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/notify"
+)
+
+const (
+	// notificationAppName is shown as the sender of every notification
+	notificationAppName = "Go Commands"
+	// defaultNotificationTitle is used for notifications without a title
+	defaultNotificationTitle = "Home Assistant"
+)
+
+// urgencies maps the urgency names accepted in a notification to their levels
+var urgencies = map[string]byte{
+	"low":      notify.UrgencyLow,
+	"normal":   notify.UrgencyNormal,
+	"critical": notify.UrgencyCritical,
+}
+
+var (
+	notifyMu     sync.Mutex
+	notifyClient *notify.Client
+
+	// sent holds the notifications shown on this run by ID, so events from
+	// other applications' notifications are ignored
+	sentMu sync.Mutex
+	sent   = map[uint32]Notification{}
+	// acted holds the notifications an action was clicked on, as servers
+	// such as GNOME then close them as if they were dismissed
+	acted = map[uint32]bool{}
+)
+
+// notifications returns the client for the notification server, connecting
+// to the session bus on first use
+var notifications = func() (*notify.Client, error) {
+	notifyMu.Lock()
+	defer notifyMu.Unlock()
+
+	if notifyClient == nil {
+		client, err := notify.Connect()
+		if err != nil {
+			return nil, err
+		}
+		notifyClient = client
+	}
+	return notifyClient, nil
+}
+
+// Notification is a desktop notification sent from Home Assistant
+type Notification struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	// Urgency is low, normal or critical
+	Urgency string `json:"urgency"`
+	// Icon is an icon name from the theme, or a file path
+	Icon string `json:"icon"`
+	// Timeout is how many seconds the notification is shown. Zero shows it
+	// until it is dismissed, and nil leaves it to the desktop.
+	Timeout *float64 `json:"timeout"`
+	// Actions are buttons on the notification, reported back when clicked
+	Actions []NotificationAction `json:"actions"`
+	// Tag is included in events so automations can tell notifications apart
+	Tag string `json:"tag"`
+}
+
+// NotificationAction is a button on a notification
+type NotificationAction struct {
+	// Action is reported back when the button is clicked
+	Action string `json:"action"`
+	// Title is shown on the button
+	Title string `json:"title"`
+}
+
+func init() {
+	entity.Register("notify", GetNotifyEntities)
+}
+
+// ParseNotification reads a notification from a JSON object, or uses the
+// payload as the message if it is plain text
+func ParseNotification(payload string) (Notification, error) {
+	var n Notification
+	if strings.HasPrefix(strings.TrimSpace(payload), "{") {
+		if err := json.Unmarshal([]byte(payload), &n); err != nil {
+			return n, fmt.Errorf("invalid notification: %v", err)
+		}
+	} else {
+		n.Message = payload
+	}
+
+	if n.Title == "" {
+		n.Title = defaultNotificationTitle
+	}
+	if n.Urgency == "" {
+		n.Urgency = "normal"
+	}
+	if _, ok := urgencies[n.Urgency]; !ok {
+		return n, fmt.Errorf("invalid urgency %q, expected low, normal or critical", n.Urgency)
+	}
+	if n.Timeout != nil && *n.Timeout < 0 {
+		return n, fmt.Errorf("invalid timeout %v, expected seconds", *n.Timeout)
+	}
+	for _, action := range n.Actions {
+		if action.Action == "" || action.Title == "" {
+			return n, fmt.Errorf("invalid action %+v, expected an action and title", action)
+		}
+	}
+	return n, nil
+}
+
+// Notify shows a desktop notification
+func Notify(n Notification) error {
+	switch goos {
+	case "linux":
+		client, err := notifications()
+		if err != nil {
+			return err
+		}
+		desktop := notify.Notification{
+			AppName: notificationAppName,
+			Icon:    n.Icon,
+			Summary: n.Title,
+			Body:    n.Message,
+			Urgency: urgencies[n.Urgency],
+			Expire:  notify.ExpireDefault,
+		}
+		if n.Timeout != nil {
+			desktop.Expire = time.Duration(*n.Timeout * float64(time.Second))
+		}
+		for _, action := range n.Actions {
+			desktop.Actions = append(desktop.Actions, notify.Action{Key: action.Action, Label: action.Title})
+		}
+
+		id, err := client.Notify(desktop)
+		if err != nil {
+			return err
+		}
+		sentMu.Lock()
+		sent[id] = n
+		sentMu.Unlock()
+		return nil
+	case "darwin":
+		return run("osascript", "-e", fmt.Sprintf("display notification %q with title %q", n.Message, n.Title))
+	default:
+		return fmt.Errorf("notifications not supported on %s", goos)
+	}
+}
+
+// watchNotifications publishes an event when an action on one of our
+// notifications is clicked or the user dismisses one
+func watchNotifications(fire func(payload any), stop <-chan struct{}) {
+	client, err := notifications()
+	if err != nil {
+		log.Error("Failed to watch notifications", "error", err)
+		<-stop
+		return
+	}
+
+	err = client.Watch(func(e notify.Event) {
+		sentMu.Lock()
+		n, ok := sent[e.ID]
+		clicked := acted[e.ID]
+		if ok && e.Action != "" {
+			acted[e.ID] = true
+		} else if ok {
+			delete(sent, e.ID)
+			delete(acted, e.ID)
+		}
+		sentMu.Unlock()
+		if !ok {
+			return
+		}
+
+		event := map[string]any{"title": n.Title, "tag": n.Tag}
+		switch {
+		case e.Action != "":
+			event["event_type"] = "action"
+			event["action"] = e.Action
+		case e.Reason == notify.ReasonDismissed && !clicked:
+			event["event_type"] = "dismissed"
+		default:
+			return
+		}
+		log.Info("Notification event", "event", event["event_type"], "action", e.Action, "tag", n.Tag)
+		fire(event)
+	}, stop)
+	if err != nil {
+		log.Error("Stopped watching notifications", "error", err)
+	}
+}
+
+// GetNotifyEntities returns a notify entity that shows desktop notifications
+// and, on Linux, an event entity reporting clicked actions
+func GetNotifyEntities() []entity.Entity {
+	switch goos {
+	case "linux":
+		if _, err := notifications(); err != nil {
+			log.Debug("Notifications are not available", "reason", err)
+			return nil
+		}
+	case "darwin":
+	default:
+		return nil
+	}
+
+	entities := []entity.Entity{
+		{
+			Component: "notify",
+			ID:        "notification",
+			Name:      "Notification",
+			Icon:      "mdi:message-badge",
+			Command: func(payload string) error {
+				n, err := ParseNotification(payload)
+				if err != nil {
+					return err
+				}
+				return Notify(n)
+			},
+		},
+	}
+	if goos == "linux" {
+		entities = append(entities, entity.Entity{
+			Component: "event",
+			ID:        "notification_action",
+			Name:      "Notification Action",
+			Icon:      "mdi:gesture-tap-button",
+			Config:    map[string]any{"event_types": []string{"action", "dismissed"}},
+			Events:    watchNotifications,
+		})
+	}
+	return entities
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/notify"
+	"github.com/timmo001/go-commands/notify/notifytest"
+)
+
+// fakeNotifications points notifications at a stand-in notification server on a private bus
+func fakeNotifications(t *testing.T) *notifytest.Server {
+	t.Helper()
+
+	address := dbustest.NewBus(t)
+	server := notifytest.NewServer(t, address)
+	client := notify.NewClient(dbustest.Connect(t, address))
+	notifications = func() (*notify.Client, error) { return client, nil }
+	return server
+}
+
+func TestParseNotification(t *testing.T) {
+	n, err := ParseNotification("Backup finished")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n.Message != "Backup finished" || n.Title != "Home Assistant" || n.Urgency != "normal" || n.Timeout != nil {
+		t.Errorf("plain text notification = %+v", n)
+	}
+
+	n, err = ParseNotification(`{"title":"Door","message":"Front door open","urgency":"critical","icon":"dialog-warning","timeout":0,"tag":"door","actions":[{"action":"lock","title":"Lock"}]}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Notification{
+		Title:   "Door",
+		Message: "Front door open",
+		Urgency: "critical",
+		Icon:    "dialog-warning",
+		Timeout: new(float64),
+		Actions: []NotificationAction{{Action: "lock", Title: "Lock"}},
+		Tag:     "door",
+	}
+	if !reflect.DeepEqual(n, want) {
+		t.Errorf("notification = %+v, want %+v", n, want)
+	}
+
+	for _, payload := range []string{
+		`{"message":`,
+		`{"message":"Hi","urgency":"urgent"}`,
+		`{"message":"Hi","timeout":-1}`,
+		`{"message":"Hi","actions":[{"action":"open"}]}`,
+	} {
+		if _, err := ParseNotification(payload); err == nil {
+			t.Errorf("ParseNotification(%s) succeeded, want an error", payload)
+		}
+	}
+}
+
+func TestNotifyOverDBus(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	server := fakeNotifications(t)
+
+	n, _ := ParseNotification(`{"title":"Door","message":"Front door open","urgency":"critical","timeout":10,"tag":"door","actions":[{"action":"lock","title":"Lock"}]}`)
+	if err := Notify(n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := notify.Notification{
+		AppName: "Go Commands",
+		Summary: "Door",
+		Body:    "Front door open",
+		Actions: []notify.Action{{Key: "lock", Label: "Lock"}},
+		Urgency: notify.UrgencyCritical,
+		Expire:  10 * time.Second,
+	}
+	if shown := server.Notifications(); len(shown) != 1 || !reflect.DeepEqual(shown[0], want) {
+		t.Errorf("notifications = %+v, want %+v", shown, want)
+	}
+	assertLines(t, recorder)
+}
+
+func TestNotificationEvents(t *testing.T) {
+	fakeHost(t, "linux")
+	server := fakeNotifications(t)
+
+	n, _ := ParseNotification(`{"message":"Front door open","tag":"door","actions":[{"action":"lock","title":"Lock"}]}`)
+	if err := Notify(n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	events := make(chan any, 16)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watchNotifications(func(payload any) { events <- payload }, stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// Emit until the watch is listening. Notification 2 belongs to another
+	// application and is ignored.
+	var got any
+	deadline := time.After(5 * time.Second)
+	for got == nil {
+		_ = server.Invoke(2, "reply")
+		_ = server.Invoke(1, "lock")
+		select {
+		case got = <-events:
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event published")
+		}
+	}
+
+	want := map[string]any{"event_type": "action", "action": "lock", "title": "Home Assistant", "tag": "door"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("event = %v, want %v", got, want)
+	}
+
+	// Closing a notification after an action was clicked is not a dismissal
+	if err := server.Close(1, notify.ReasonDismissed); err != nil {
+		t.Fatal(err)
+	}
+	n, _ = ParseNotification(`{"message":"Window open","tag":"window"}`)
+	if err := Notify(n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := server.Close(2, notify.ReasonDismissed); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case got = <-events:
+			if got.(map[string]any)["event_type"] != "dismissed" {
+				continue
+			}
+		case <-deadline:
+			t.Fatal("no dismissed event published")
+		}
+		break
+	}
+	if tag := got.(map[string]any)["tag"]; tag != "window" {
+		t.Errorf("dismissed event for %v, want only the window notification", tag)
+	}
+}
+
+func TestNotifyOnDarwin(t *testing.T) {
+	recorder := fakeHost(t, "darwin")
+
+	n, _ := ParseNotification("Backup finished")
+	if err := Notify(n); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertLines(t, recorder, `osascript -e display notification "Backup finished" with title "Home Assistant"`)
+}
+
+func TestGetNotifyEntitiesPerOS(t *testing.T) {
+	for os, want := range map[string]int{"linux": 0, "darwin": 1, "windows": 0} {
+		t.Run(os, func(t *testing.T) {
+			// Without a notification server in tests, Linux has no entities
+			fakeHost(t, os)
+
+			if got := len(GetNotifyEntities()); got != want {
+				t.Errorf("got %d entities, want %d", got, want)
+			}
+		})
+	}
+
+	fakeHost(t, "linux")
+	fakeNotifications(t)
+	entities := GetNotifyEntities()
+	if len(entities) != 2 || entities[0].Component != "notify" || entities[1].Component != "event" {
+		t.Errorf("unexpected entities on linux with a notification server: %+v", entities)
+	}
+}
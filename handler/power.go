@@ -2,200 +2,289 @@ package handler
 
 import (
 	"fmt"
-	"os/exec"
-	"runtime"
 	"strings"
+	"sync"
+
+	"github.com/timmo001/go-commands/logind"
+)
+
+var (
+	logindMu     sync.Mutex
+	logindClient *logind.Client
 )
 
-// PowerCommand represents a power-related command
-type PowerCommand struct {
-	Name        string
-	Icon        string
-	Description string
-	Handler     func() error
+// loginManager returns the client for systemd-logind, connecting to the
+// system bus on first use
+var loginManager = func() (*logind.Client, error) {
+	logindMu.Lock()
+	defer logindMu.Unlock()
+
+	if logindClient == nil {
+		client, err := logind.Connect()
+		if err != nil {
+			return nil, err
+		}
+		logindClient = client
+	}
+	return logindClient, nil
+}
+
+// login returns the logind client on Linux systems running systemd-logind, or nil
+func login() *logind.Client {
+	if goos != "linux" {
+		return nil
+	}
+	client, err := loginManager()
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+func init() {
+	Register("power", GetPowerCommands)
 }
 
 // GetPowerCommands returns all available power commands
-func GetPowerCommands() []PowerCommand {
-	commands := []PowerCommand{
-		{
-			Name:        "Shutdown",
-			Icon:        "mdi:power",
-			Description: "Shutdown the system",
-			Handler:     Shutdown,
-		},
-		{
-			Name:        "Restart",
-			Icon:        "mdi:restart",
-			Description: "Restart the system",
-			Handler:     Restart,
-		},
-		{
-			Name:        "Sleep",
-			Icon:        "mdi:power-sleep",
-			Description: "Put the system to sleep",
-			Handler:     Sleep,
-		},
-		{
-			Name:        "Hibernate",
-			Icon:        "mdi:power-sleep",
-			Description: "Hibernate the system",
-			Handler:     Hibernate,
-		},
-		{
-			Name:        "Lock",
-			Icon:        "mdi:lock",
-			Description: "Lock the system",
-			Handler:     Lock,
-		},
-		{
-			Name:        "Logout",
-			Icon:        "mdi:logout",
-			Description: "Log out the current user",
-			Handler:     Logout,
-		},
-	}
-
-	if runtime.GOOS == "linux" {
-		commands = append(commands, PowerCommand{
-			Name:        "Restart to Windows",
-			Icon:        "mdi:microsoft-windows",
-			Description: "Restart the system to Windows",
-			Handler:     RestartToWindows,
-		})
+func GetPowerCommands() []Command {
+	commands := []Command{
+		NewProbedCommand("Shutdown", "mdi:power", "Shutdown the system after the power delay", ScheduleShutdown, powerProbe(logind.PowerOff, "shutdown")),
+		NewProbedCommand("Restart", "mdi:restart", "Restart the system after the power delay", ScheduleRestart, powerProbe(logind.Reboot, "shutdown")),
+		NewProbedCommand("Cancel Power Action", "mdi:cancel", "Cancel a scheduled shutdown or restart", CancelPowerAction, probePowerSchedule),
+		NewProbedCommand("Sleep", "mdi:power-sleep", "Put the system to sleep", Sleep, powerProbe(logind.Suspend, "systemctl")),
+		NewProbedCommand("Hibernate", "mdi:power-sleep", "Hibernate the system", Hibernate, probeHibernate),
+		NewCommand("Lock", "mdi:lock", "Lock the system", Lock),
+		NewCommand("Logout", "mdi:logout", "Log out the current user", Logout),
+	}
+
+	if goos == "linux" {
+		commands = append(commands,
+			NewProbedCommand("Hybrid Sleep", "mdi:power-sleep", "Put the system to sleep and save it to disk", HybridSleep, logindProbe(logind.HybridSleep)),
+			NewProbedCommand("Suspend then Hibernate", "mdi:power-sleep", "Put the system to sleep, then hibernate it later", SuspendThenHibernate, logindProbe(logind.SuspendThenHibernate)),
+			NewProbedCommand("Restart to Windows", "mdi:microsoft-windows", "Restart the system to Windows", RestartToWindows, probeRestartToWindows),
+		)
 	}
 
 	return commands
 }
 
-// GetButtonConfig returns the Home Assistant button configuration for a power command
-func GetButtonConfig(device map[string]any, uniqueID string, baseTopic string, cmd PowerCommand) (string, map[string]interface{}) {
-	nameAsId := strings.ReplaceAll(strings.ToLower(cmd.Name), " ", "_")
-	return nameAsId, map[string]any{
-		"name":               fmt.Sprintf("%s", cmd.Name),
-		"unique_id":          fmt.Sprintf("%s_power_%s", uniqueID, nameAsId),
-		"command_topic":      fmt.Sprintf("%s/power/%s", baseTopic, nameAsId),
-		"availability_topic": fmt.Sprintf("%s/availability", baseTopic),
-		"icon":               cmd.Icon,
-		"device":             device,
+// powerProbe checks that a power action is available. On Linux it asks
+// logind, or without logind checks the program used instead is installed.
+func powerProbe(action, program string) func() error {
+	return func() error {
+		switch goos {
+		case "windows", "darwin":
+			return nil
+		case "linux":
+			if manager := login(); manager != nil {
+				return logindCan(manager, action)
+			}
+			return lookPath(program)
+		default:
+			return fmt.Errorf("power control not supported on %s", goos)
+		}
+	}
+}
+
+// logindProbe checks that logind offers a power action
+func logindProbe(action string) func() error {
+	return func() error {
+		manager := login()
+		if manager == nil {
+			return fmt.Errorf("systemd-logind is not available")
+		}
+		return logindCan(manager, action)
+	}
+}
+
+// logindCan explains why logind does not offer a power action
+func logindCan(manager *logind.Client, action string) error {
+	result, err := manager.Can(action)
+	if err != nil {
+		return err
+	}
+	// Actions run without asking for authorization, so challenge is as good as no
+	switch result {
+	case "yes":
+		return nil
+	case "challenge":
+		return fmt.Errorf("%s needs interactive authorization, allow it for this user with a polkit rule", action)
+	case "na":
+		return fmt.Errorf("%s is not supported by this machine", action)
+	case "no":
+		return fmt.Errorf("%s is not allowed for this user", action)
+	default:
+		return fmt.Errorf("%s is not available: %s", action, result)
+	}
+}
+
+// probeHibernate checks that the system can hibernate
+func probeHibernate() error {
+	if goos == "darwin" {
+		return fmt.Errorf("hibernate not supported on macOS")
 	}
+	return powerProbe(logind.Hibernate, "systemctl")()
 }
 
-// Shutdown shuts down the system
+// probeRestartToWindows checks that efibootmgr is installed and finds a Windows boot entry
+func probeRestartToWindows() error {
+	if goos != "linux" {
+		return fmt.Errorf("restarting to Windows is only supported on Linux")
+	}
+	if err := lookPath("efibootmgr"); err != nil {
+		return err
+	}
+	_, err := windowsBootEntry()
+	return err
+}
+
+// Shutdown shuts down the system immediately
 func Shutdown() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("shutdown", "/s")
-		return cmd.Run()
+		return run("shutdown", "/s", "/t", "0")
 	case "linux":
-		cmd := exec.Command("shutdown", "-h", "now")
-		return cmd.Run()
+		if manager := login(); manager != nil {
+			return manager.Do(logind.PowerOff)
+		}
+		return run("shutdown", "-h", "now")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to shut down")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to shut down")
 	default:
-		return fmt.Errorf("shutdown not supported on %s", runtime.GOOS)
+		return fmt.Errorf("shutdown not supported on %s", goos)
 	}
 }
 
-// Restart restarts the system
+// Restart restarts the system immediately
 func Restart() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("shutdown", "/r")
-		return cmd.Run()
+		return run("shutdown", "/r", "/t", "0")
 	case "linux":
-		cmd := exec.Command("shutdown", "-r", "now")
-		return cmd.Run()
+		if manager := login(); manager != nil {
+			return manager.Do(logind.Reboot)
+		}
+		return run("shutdown", "-r", "now")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to restart")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to restart")
 	default:
-		return fmt.Errorf("restart not supported on %s", runtime.GOOS)
+		return fmt.Errorf("restart not supported on %s", goos)
 	}
 }
 
-// RestartToWindows restarts the system to Windows using the Windows Boot Manager efi entry
+// RestartToWindows restarts the system to Windows using the Windows Boot
+// Manager efi entry once the power delay has passed
 func RestartToWindows() error {
-	if runtime.GOOS != "linux" {
+	if goos != "linux" {
 		return fmt.Errorf("restarting to Windows is only supported on Linux")
 	}
 
-	// Find the Windows Boot Manager entry
-	cmd := exec.Command("sudo", "efibootmgr")
-	output, err := cmd.Output()
+	bootEntry, err := windowsBootEntry()
 	if err != nil {
-		return fmt.Errorf("failed to run efibootmgr: %v", err)
+		return err
+	}
+
+	return powerSchedule.Schedule("Restart", func() error {
+		// Set Windows Boot Manager as next boot option only now, so a
+		// cancelled restart leaves the next boot alone
+		if err := run("sudo", "efibootmgr", "--bootnext", bootEntry); err != nil {
+			return fmt.Errorf("failed to set Windows Boot Manager as next boot option: %v", err)
+		}
+
+		// Reboot the system
+		return Restart()
+	})
+}
+
+// windowsBootEntry returns the boot number of the Windows Boot Manager efi entry
+func windowsBootEntry() (string, error) {
+	bootEntries, err := output("sudo", "efibootmgr")
+	if err != nil {
+		return "", fmt.Errorf("failed to run efibootmgr: %v", err)
 	}
 
 	// Parse the output to find Windows Boot Manager entry
-	bootEntry := ""
-	lines := strings.Split(string(output), "\n")
+	lines := strings.Split(string(bootEntries), "\n")
 	for _, line := range lines {
 		if strings.Contains(line, "Windows Boot Manager") {
 			// Extract the boot number (e.g., "Boot0000*" -> "0000")
 			parts := strings.Split(line, "*")
 			if len(parts) > 0 {
-				bootEntry = strings.TrimPrefix(parts[0], "Boot")
+				return strings.TrimPrefix(parts[0], "Boot"), nil
 			}
 			break
 		}
 	}
 
-	if bootEntry == "" {
-		return fmt.Errorf("Windows Boot Manager not found")
-	}
-
-	// Set Windows Boot Manager as next boot option
-	cmd = exec.Command("sudo", "efibootmgr", "--bootnext", bootEntry)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set Windows Boot Manager as next boot option: %v", err)
-	}
-
-	// Reboot the system
-	return Restart()
+	return "", fmt.Errorf("Windows Boot Manager not found")
 }
 
 // Sleep puts the system to sleep
 func Sleep() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("rundll32.exe", "powrprof.dll,SetSuspendState", "0,1,0")
-		return cmd.Run()
+		return run("rundll32.exe", "powrprof.dll,SetSuspendState", "0,1,0")
 	case "linux":
-		cmd := exec.Command("systemctl", "suspend")
-		return cmd.Run()
+		if manager := login(); manager != nil {
+			return manager.Do(logind.Suspend)
+		}
+		return run("systemctl", "suspend")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to sleep")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to sleep")
 	default:
-		return fmt.Errorf("sleep not supported on %s", runtime.GOOS)
+		return fmt.Errorf("sleep not supported on %s", goos)
 	}
 }
 
 // Hibernate hibernates the system
 func Hibernate() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("shutdown", "/h")
-		return cmd.Run()
+		return run("shutdown", "/h")
 	case "linux":
-		cmd := exec.Command("systemctl", "hibernate")
-		return cmd.Run()
+		if manager := login(); manager != nil {
+			return manager.Do(logind.Hibernate)
+		}
+		return run("systemctl", "hibernate")
 	case "darwin":
 		return fmt.Errorf("hibernate not supported on macOS")
 	default:
-		return fmt.Errorf("hibernate not supported on %s", runtime.GOOS)
+		return fmt.Errorf("hibernate not supported on %s", goos)
+	}
+}
+
+// HybridSleep puts the system to sleep and saves it to disk, so it resumes
+// quickly but survives losing power
+func HybridSleep() error {
+	manager := login()
+	if manager == nil {
+		return fmt.Errorf("hybrid sleep is only supported on Linux with systemd-logind")
 	}
+	return manager.Do(logind.HybridSleep)
+}
+
+// SuspendThenHibernate puts the system to sleep and hibernates it after the
+// delay configured in systemd-sleep
+func SuspendThenHibernate() error {
+	manager := login()
+	if manager == nil {
+		return fmt.Errorf("suspend then hibernate is only supported on Linux with systemd-logind")
+	}
+	return manager.Do(logind.SuspendThenHibernate)
 }
 
 // Lock locks the system
 func Lock() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("rundll32.exe", "user32.dll,LockWorkStation")
-		return cmd.Run()
+		return run("rundll32.exe", "user32.dll,LockWorkStation")
 	case "linux":
+		if manager := login(); manager != nil {
+			if err := manager.LockSession(); err == nil {
+				return nil
+			}
+		}
+
 		// Try different commands for different desktop environments
 		commands := [][]string{
 			{"loginctl", "lock-session"},                                     // systemd
@@ -205,26 +294,23 @@ func Lock() error {
 		}
 
 		for _, cmdArgs := range commands {
-			cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-			if err := cmd.Run(); err == nil {
+			if err := run(cmdArgs[0], cmdArgs[1:]...); err == nil {
 				return nil
 			}
 		}
 		return fmt.Errorf("failed to lock screen")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to keystroke \"q\" using {command down, control down}")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to keystroke \"q\" using {command down, control down}")
 	default:
-		return fmt.Errorf("lock not supported on %s", runtime.GOOS)
+		return fmt.Errorf("lock not supported on %s", goos)
 	}
 }
 
 // Logout logs out the current user
 func Logout() error {
-	switch runtime.GOOS {
+	switch goos {
 	case "windows":
-		cmd := exec.Command("shutdown", "/l")
-		return cmd.Run()
+		return run("shutdown", "/l")
 	case "linux":
 		// Try different commands for different desktop environments
 		commands := [][]string{
@@ -234,16 +320,14 @@ func Logout() error {
 		}
 
 		for _, cmdArgs := range commands {
-			cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
-			if err := cmd.Run(); err == nil {
+			if err := run(cmdArgs[0], cmdArgs[1:]...); err == nil {
 				return nil
 			}
 		}
 		return fmt.Errorf("failed to logout")
 	case "darwin":
-		cmd := exec.Command("osascript", "-e", "tell application \"System Events\" to log out")
-		return cmd.Run()
+		return run("osascript", "-e", "tell application \"System Events\" to log out")
 	default:
-		return fmt.Errorf("logout not supported on %s", runtime.GOOS)
+		return fmt.Errorf("logout not supported on %s", goos)
 	}
 }
@@ -0,0 +1,327 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/logind"
+	"github.com/timmo001/go-commands/logind/logindtest"
+)
+
+func TestPowerCommandsPerOS(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func() error
+		want    map[string]string
+	}{
+		{
+			name:    "Shutdown",
+			handler: Shutdown,
+			want: map[string]string{
+				"windows": "shutdown /s /t 0",
+				"linux":   "shutdown -h now",
+				"darwin":  `osascript -e tell application "System Events" to shut down`,
+			},
+		},
+		{
+			name:    "Restart",
+			handler: Restart,
+			want: map[string]string{
+				"windows": "shutdown /r /t 0",
+				"linux":   "shutdown -r now",
+				"darwin":  `osascript -e tell application "System Events" to restart`,
+			},
+		},
+		{
+			name:    "Sleep",
+			handler: Sleep,
+			want: map[string]string{
+				"windows": "rundll32.exe powrprof.dll,SetSuspendState 0,1,0",
+				"linux":   "systemctl suspend",
+				"darwin":  `osascript -e tell application "System Events" to sleep`,
+			},
+		},
+		{
+			name:    "Hibernate",
+			handler: Hibernate,
+			want: map[string]string{
+				"windows": "shutdown /h",
+				"linux":   "systemctl hibernate",
+			},
+		},
+		{
+			name:    "Lock",
+			handler: Lock,
+			want: map[string]string{
+				"windows": "rundll32.exe user32.dll,LockWorkStation",
+				"linux":   "loginctl lock-session",
+				"darwin":  `osascript -e tell application "System Events" to keystroke "q" using {command down, control down}`,
+			},
+		},
+		{
+			name:    "Logout",
+			handler: Logout,
+			want: map[string]string{
+				"windows": "shutdown /l",
+				"linux":   "gnome-session-quit --no-prompt",
+				"darwin":  `osascript -e tell application "System Events" to log out`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, os := range []string{"windows", "linux", "darwin", "plan9"} {
+			t.Run(tt.name+"/"+os, func(t *testing.T) {
+				recorder := fakeHost(t, os)
+
+				err := tt.handler()
+
+				want, supported := tt.want[os]
+				if !supported {
+					if err == nil {
+						t.Fatalf("expected an error on %s", os)
+					}
+					assertLines(t, recorder)
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				assertLines(t, recorder, want)
+			})
+		}
+	}
+}
+
+func TestLockFallbackChain(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Errors["loginctl"] = errors.New("no session")
+	recorder.Errors["gnome-screensaver-command"] = errors.New("not installed")
+	recorder.Errors["qdbus"] = errors.New("not installed")
+
+	if err := Lock(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertLines(t, recorder,
+		"loginctl lock-session",
+		"gnome-screensaver-command -l",
+		"qdbus org.freedesktop.ScreenSaver /ScreenSaver Lock",
+		"xdg-screensaver lock",
+	)
+}
+
+func TestLockFallbackChainExhausted(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	for _, name := range []string{"loginctl", "gnome-screensaver-command", "qdbus", "xdg-screensaver"} {
+		recorder.Errors[name] = errors.New("failed")
+	}
+
+	if err := Lock(); err == nil {
+		t.Fatal("expected an error when every lock command fails")
+	}
+	if got := len(recorder.Calls()); got != 4 {
+		t.Errorf("ran %d commands, want 4", got)
+	}
+}
+
+func TestLogoutFallbackChain(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Errors["gnome-session-quit"] = errors.New("not installed")
+
+	if err := Logout(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertLines(t, recorder,
+		"gnome-session-quit --no-prompt",
+		"qdbus org.kde.ksmserver /KSMServer logout 0 0 0",
+	)
+}
+
+func TestRestartToWindows(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Outputs["sudo efibootmgr"] = []byte("BootCurrent: 0001\nBoot0001* Linux Boot Manager\nBoot0000* Windows Boot Manager\tHD(1,GPT)\n")
+
+	if err := RestartToWindows(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	assertLines(t, recorder,
+		"sudo efibootmgr",
+		"sudo efibootmgr --bootnext 0000",
+		"shutdown -r now",
+	)
+}
+
+func TestRestartToWindowsWaitsForDelay(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Outputs["sudo efibootmgr"] = []byte("Boot0001* Linux Boot Manager\nBoot0000* Windows Boot Manager\tHD(1,GPT)\n")
+	previous := powerSchedule
+	powerSchedule = NewPowerSchedule()
+	t.Cleanup(func() { powerSchedule = previous })
+	powerSchedule.SetDelay(5 * time.Minute)
+
+	if err := RestartToWindows(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if action, _ := powerSchedule.Pending(); action != "Restart" {
+		t.Fatalf("pending action = %q, want Restart", action)
+	}
+	if err := CancelPowerAction(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, line := range recorder.Lines() {
+		if strings.Contains(line, "--bootnext") || strings.HasPrefix(line, "shutdown") {
+			t.Errorf("ran %q before the delay passed", line)
+		}
+	}
+}
+
+func TestRestartToWindowsWithoutEntry(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Outputs["sudo efibootmgr"] = []byte("BootCurrent: 0001\nBoot0001* Linux Boot Manager\n")
+
+	if err := RestartToWindows(); err == nil {
+		t.Fatal("expected an error without a Windows Boot Manager entry")
+	}
+	assertLines(t, recorder, "sudo efibootmgr")
+}
+
+func TestRestartToWindowsOnlyOnLinux(t *testing.T) {
+	for _, os := range []string{"windows", "darwin"} {
+		t.Run(os, func(t *testing.T) {
+			recorder := fakeHost(t, os)
+
+			if err := RestartToWindows(); err == nil {
+				t.Fatal("expected an error")
+			}
+			assertLines(t, recorder)
+		})
+	}
+}
+
+func TestGetPowerCommandsPerOS(t *testing.T) {
+	for os, want := range map[string]int{"linux": 10, "windows": 7, "darwin": 7} {
+		t.Run(os, func(t *testing.T) {
+			fakeHost(t, os)
+
+			if got := len(GetPowerCommands()); got != want {
+				t.Errorf("got %d commands, want %d", got, want)
+			}
+		})
+	}
+}
+
+// fakeLogind points power commands at a stand-in logind on a private bus
+// with an active session for the current user
+func fakeLogind(t *testing.T) *logindtest.Manager {
+	t.Helper()
+
+	address := dbustest.NewBus(t)
+	manager := logindtest.NewManager(t, address, logindtest.Session{ID: "2", UID: uint32(os.Getuid()), Active: true})
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	previous := loginManager
+	loginManager = func() (*logind.Client, error) { return client, nil }
+	t.Cleanup(func() { loginManager = previous })
+	return manager
+}
+
+// unsupportedCommands probes every power command and returns the names of those that fail
+func unsupportedCommands(t *testing.T) []string {
+	t.Helper()
+
+	var names []string
+	for _, cmd := range GetPowerCommands() {
+		if err := Probe(cmd); err != nil {
+			names = append(names, cmd.Name())
+		}
+	}
+	return names
+}
+
+func TestProbePowerCommandsWithLogind(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Outputs["sudo efibootmgr"] = []byte("BootCurrent: 0001\nBoot0000* Windows Boot Manager\n")
+	manager := fakeLogind(t)
+	manager.SetCapability(logind.Hibernate, "na")
+	manager.SetCapability(logind.SuspendThenHibernate, "no")
+	manager.SetCapability(logind.Reboot, "challenge")
+
+	// Restart needs authorization, which is never asked for
+	want := []string{"Restart", "Hibernate", "Suspend then Hibernate"}
+	if got := unsupportedCommands(t); !slices.Equal(got, want) {
+		t.Errorf("unsupported commands = %q, want %q", got, want)
+	}
+	if err := powerProbe(logind.Reboot, "shutdown")(); err == nil || !strings.Contains(err.Error(), "polkit") {
+		t.Errorf("probe error = %v, want the polkit reason", err)
+	}
+}
+
+func TestProbePowerCommandsWithoutLogind(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Missing["efibootmgr"] = true
+	recorder.Missing["systemctl"] = true
+
+	want := []string{"Sleep", "Hibernate", "Hybrid Sleep", "Suspend then Hibernate", "Restart to Windows"}
+	if got := unsupportedCommands(t); !slices.Equal(got, want) {
+		t.Errorf("unsupported commands = %q, want %q", got, want)
+	}
+}
+
+func TestProbePowerCommandsPerOS(t *testing.T) {
+	fakeHost(t, "darwin")
+	if got := unsupportedCommands(t); !slices.Equal(got, []string{"Hibernate"}) {
+		t.Errorf("unsupported commands on darwin = %q, want Hibernate", got)
+	}
+
+	fakeHost(t, "windows")
+	if got := unsupportedCommands(t); len(got) != 0 {
+		t.Errorf("unsupported commands on windows = %q, want none", got)
+	}
+}
+
+func TestProbeRestartToWindowsWithoutEntry(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Outputs["sudo efibootmgr"] = []byte("BootCurrent: 0001\nBoot0001* Linux Boot Manager\n")
+
+	if err := probeRestartToWindows(); err == nil {
+		t.Error("expected an error without a Windows boot entry")
+	}
+}
+
+func TestPowerCommandsWithLogind(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	manager := fakeLogind(t)
+
+	for _, handler := range []func() error{Shutdown, Restart, Sleep, Hibernate, HybridSleep, SuspendThenHibernate, Lock} {
+		if err := handler(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	want := []string{"PowerOff", "Reboot", "Suspend", "Hibernate", "HybridSleep", "SuspendThenHibernate", "Lock 2"}
+	if calls := manager.Calls(); !slices.Equal(calls, want) {
+		t.Errorf("logind calls = %q, want %q", calls, want)
+	}
+	assertLines(t, recorder)
+}
+
+func TestHybridSleepWithoutLogind(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+
+	if err := HybridSleep(); err == nil {
+		t.Error("expected an error without logind")
+	}
+	if err := SuspendThenHibernate(); err == nil {
+		t.Error("expected an error without logind")
+	}
+	assertLines(t, recorder)
+}
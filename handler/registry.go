@@ -0,0 +1,41 @@
+package handler
+
+import "sync"
+
+// Category is a named group of commands, such as power or media
+type Category struct {
+	// Name is used in topics and unique IDs, e.g. "power"
+	Name string
+	// Commands returns the commands available in this category
+	Commands func() []Command
+}
+
+var (
+	registryMu sync.RWMutex
+	categories []Category
+)
+
+// Register adds a command category to the registry. Registering a name
+// that already exists replaces the previous provider.
+func Register(name string, commands func() []Command) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for i, category := range categories {
+		if category.Name == name {
+			categories[i].Commands = commands
+			return
+		}
+	}
+	categories = append(categories, Category{Name: name, Commands: commands})
+}
+
+// Categories returns all registered command categories in registration order
+func Categories() []Category {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	result := make([]Category, len(categories))
+	copy(result, categories)
+	return result
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/logind"
+)
+
+const (
+	// powerWarning is how long before a scheduled action the final warning is shown
+	powerWarning = time.Minute
+	// countdownInterval is how often the time remaining is published while an action is scheduled
+	countdownInterval = 10 * time.Second
+)
+
+// PowerSchedule runs a shutdown or restart after a delay, giving logged-in
+// users a warning and a chance to cancel it
+type PowerSchedule struct {
+	mu    sync.Mutex
+	delay time.Duration
+	// action names the scheduled action, or is empty when nothing is scheduled
+	action  string
+	at      time.Time
+	timer   *time.Timer
+	warning *time.Timer
+	// scheduling counts how often an action has been scheduled, so a timer
+	// that fires just as another action is scheduled does nothing
+	scheduling int
+
+	// Notifier reports when an action is scheduled or cancelled
+	entity.Notifier
+}
+
+// powerSchedule is the schedule used by the Shutdown and Restart buttons
+var powerSchedule = NewPowerSchedule()
+
+func init() {
+	entity.Register("power_schedule", GetPowerScheduleEntities)
+}
+
+// NewPowerSchedule creates a PowerSchedule that runs actions immediately
+// until a delay is set
+func NewPowerSchedule() *PowerSchedule {
+	return &PowerSchedule{}
+}
+
+// SetDelay sets how long future actions wait before they run
+func (s *PowerSchedule) SetDelay(delay time.Duration) {
+	s.mu.Lock()
+	s.delay = delay
+	s.mu.Unlock()
+	s.Notify()
+}
+
+// Delay returns how long actions wait before they run
+func (s *PowerSchedule) Delay() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.delay
+}
+
+// Schedule runs an action once the delay has passed, replacing any action
+// already scheduled. Without a delay the action runs immediately.
+func (s *PowerSchedule) Schedule(action string, run func() error) error {
+	s.mu.Lock()
+	delay := s.delay
+	if delay <= 0 {
+		s.mu.Unlock()
+		s.Cancel()
+		return run()
+	}
+
+	s.stopTimers()
+	s.scheduling++
+	scheduling := s.scheduling
+	s.action = action
+	s.at = time.Now().Add(delay)
+	s.timer = time.AfterFunc(delay, func() { s.fire(scheduling, run) })
+	if delay > powerWarning {
+		s.warning = time.AfterFunc(delay-powerWarning, func() { s.warn(scheduling) })
+	}
+	s.mu.Unlock()
+
+	log.Info("Scheduled power action", "action", action, "delay", delay)
+	warnUsers(fmt.Sprintf("%s scheduled", action), fmt.Sprintf("This computer will %s in %s.", strings.ToLower(action), formatDelay(delay)))
+	s.Notify()
+	return nil
+}
+
+// Cancel stops the scheduled action. It returns false if nothing was scheduled.
+func (s *PowerSchedule) Cancel() bool {
+	s.mu.Lock()
+	action := s.action
+	if action == "" {
+		s.mu.Unlock()
+		return false
+	}
+	s.stopTimers()
+	s.action = ""
+	s.mu.Unlock()
+
+	log.Info("Cancelled power action", "action", action)
+	warnUsers(fmt.Sprintf("%s cancelled", action), fmt.Sprintf("The scheduled %s has been cancelled.", strings.ToLower(action)))
+	s.Notify()
+	return true
+}
+
+// Pending returns the scheduled action and when it runs, or an empty action
+// if nothing is scheduled
+func (s *PowerSchedule) Pending() (string, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.action, s.at
+}
+
+// Watch calls changed when an action is scheduled or cancelled, and on an
+// interval while one is scheduled, until stop is closed
+func (s *PowerSchedule) Watch(changed func(), stop <-chan struct{}) {
+	remove := s.AddWatcher(changed)
+	defer remove()
+
+	ticker := time.NewTicker(countdownInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if action, _ := s.Pending(); action != "" {
+				changed()
+			}
+		}
+	}
+}
+
+// stopTimers stops the timers of the scheduled action. s.mu must be held.
+func (s *PowerSchedule) stopTimers() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.warning != nil {
+		s.warning.Stop()
+		s.warning = nil
+	}
+}
+
+// warn shows the final warning before an action runs
+func (s *PowerSchedule) warn(scheduling int) {
+	s.mu.Lock()
+	action := s.action
+	current := action != "" && scheduling == s.scheduling
+	s.mu.Unlock()
+	if !current {
+		return
+	}
+
+	warnUsers(fmt.Sprintf("%s soon", action), fmt.Sprintf("This computer will %s in %s. Save your work.", strings.ToLower(action), formatDelay(powerWarning)))
+}
+
+// fire runs the scheduled action, unless it was cancelled or replaced
+func (s *PowerSchedule) fire(scheduling int, run func() error) {
+	s.mu.Lock()
+	action := s.action
+	if action == "" || scheduling != s.scheduling {
+		s.mu.Unlock()
+		return
+	}
+	s.action = ""
+	s.timer, s.warning = nil, nil
+	s.mu.Unlock()
+	s.Notify()
+
+	log.Info("Running scheduled power action", "action", action)
+	if err := run(); err != nil {
+		log.Error("Failed to run scheduled power action", "error", err, "action", action)
+	}
+}
+
+// ConfigurePowerDelay sets the delay the Shutdown and Restart buttons start
+// with, so a delay survives restarts of the app
+func ConfigurePowerDelay(delay time.Duration) {
+	powerSchedule.SetDelay(delay)
+}
+
+// ScheduleShutdown shuts down the system once the power delay has passed
+func ScheduleShutdown() error {
+	return powerSchedule.Schedule("Shutdown", Shutdown)
+}
+
+// ScheduleRestart restarts the system once the power delay has passed
+func ScheduleRestart() error {
+	return powerSchedule.Schedule("Restart", Restart)
+}
+
+// CancelPowerAction cancels a scheduled shutdown or restart
+func CancelPowerAction() error {
+	if !powerSchedule.Cancel() {
+		return fmt.Errorf("no power action is scheduled")
+	}
+	return nil
+}
+
+// probePowerSchedule checks that the system can shut down or restart
+func probePowerSchedule() error {
+	if err := powerProbe(logind.PowerOff, "shutdown")(); err == nil {
+		return nil
+	}
+	return powerProbe(logind.Reboot, "shutdown")()
+}
+
+// GetPowerScheduleEntities returns the delay used by the Shutdown and Restart
+// buttons and a sensor with the time remaining before a scheduled action
+func GetPowerScheduleEntities() []entity.Entity {
+	if probePowerSchedule() != nil {
+		return nil
+	}
+
+	return []entity.Entity{
+		{
+			Component: "number",
+			ID:        "power_delay",
+			Name:      "Power Delay",
+			Icon:      "mdi:timer-cog-outline",
+			Config: map[string]any{
+				"min":                 0,
+				"max":                 config.MaxPowerDelay.Minutes(),
+				"step":                1,
+				"mode":                "box",
+				"unit_of_measurement": "min",
+			},
+			State: func() (any, error) {
+				return powerSchedule.Delay().Minutes(), nil
+			},
+			Retain: true,
+			Command: func(payload string) error {
+				minutes, err := strconv.ParseFloat(strings.TrimSpace(payload), 64)
+				if err != nil || minutes < 0 || minutes > config.MaxPowerDelay.Minutes() {
+					return fmt.Errorf("invalid delay %q, expected 0 to %v minutes", payload, config.MaxPowerDelay.Minutes())
+				}
+				powerSchedule.SetDelay(time.Duration(minutes * float64(time.Minute)))
+				return nil
+			},
+		},
+		{
+			Component: "sensor",
+			ID:        "power_action_remaining",
+			Name:      "Power Action Remaining",
+			Icon:      "mdi:timer-alert-outline",
+			Config: map[string]any{
+				"device_class":        "duration",
+				"unit_of_measurement": "s",
+			},
+			State: func() (any, error) {
+				action, at := powerSchedule.Pending()
+				if action == "" {
+					return entity.Unknown, nil
+				}
+				return math.Max(0, math.Round(time.Until(at).Seconds())), nil
+			},
+			Attributes: func() (map[string]any, error) {
+				action, at := powerSchedule.Pending()
+				if action == "" {
+					return map[string]any{"action": nil, "at": nil}, nil
+				}
+				return map[string]any{"action": action, "at": at.Format(time.RFC3339)}, nil
+			},
+			Watch: powerSchedule.Watch,
+		},
+	}
+}
+
+// formatDelay describes a delay for a warning, e.g. "5 minutes"
+func formatDelay(delay time.Duration) string {
+	minutes := int(math.Round(delay.Minutes()))
+	switch {
+	case delay < time.Minute:
+		return fmt.Sprintf("%d seconds", int(math.Round(delay.Seconds())))
+	case minutes == 1:
+		return "1 minute"
+	default:
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+}
+
+// warnUsers shows a desktop notification to logged-in users
+func warnUsers(title, message string) {
+	var err error
+	switch goos {
+	case "windows":
+		err = run("msg", "*", fmt.Sprintf("%s: %s", title, message))
+	case "linux":
+		if err = Notify(Notification{Title: title, Message: message, Urgency: "critical"}); err != nil {
+			err = run("notify-send", "--urgency=critical", "--app-name="+notificationAppName, title, message)
+		}
+	case "darwin":
+		err = run("osascript", "-e", fmt.Sprintf("display notification %q with title %q", message, title))
+	default:
+		err = fmt.Errorf("notifications not supported on %s", goos)
+	}
+	if err != nil {
+		log.Warn("Failed to warn users", "error", err, "title", title)
+	}
+}
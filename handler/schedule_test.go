@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/entity"
+)
+
+func TestPowerScheduleRunsImmediatelyWithoutDelay(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	s := NewPowerSchedule()
+
+	ran := 0
+	if err := s.Schedule("Shutdown", func() error { ran++; return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("action ran %d times, want 1", ran)
+	}
+	if action, _ := s.Pending(); action != "" {
+		t.Errorf("pending action = %q, want none", action)
+	}
+	assertLines(t, recorder)
+}
+
+func TestPowerScheduleRunsAfterDelay(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	s := NewPowerSchedule()
+	s.SetDelay(50 * time.Millisecond)
+
+	ran := make(chan struct{}, 1)
+	if err := s.Schedule("Restart", func() error { ran <- struct{}{}; return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if action, at := s.Pending(); action != "Restart" || time.Until(at) <= 0 {
+		t.Errorf("pending = %q at %v, want Restart in the future", action, at)
+	}
+
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduled action did not run")
+	}
+	if action, _ := s.Pending(); action != "" {
+		t.Errorf("pending action = %q after it ran, want none", action)
+	}
+	assertLines(t, recorder, "notify-send --urgency=critical --app-name=Go Commands Restart scheduled This computer will restart in 0 seconds.")
+}
+
+func TestPowerScheduleCancel(t *testing.T) {
+	recorder := fakeHost(t, "windows")
+	s := NewPowerSchedule()
+	s.SetDelay(5 * time.Minute)
+
+	ran := false
+	if err := s.Schedule("Shutdown", func() error { ran = true; return nil }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.Cancel() {
+		t.Fatal("expected the scheduled action to be cancelled")
+	}
+	if s.Cancel() {
+		t.Error("expected nothing left to cancel")
+	}
+	if action, _ := s.Pending(); action != "" || ran {
+		t.Errorf("pending action = %q, ran = %v after cancelling", action, ran)
+	}
+	assertLines(t, recorder,
+		"msg * Shutdown scheduled: This computer will shutdown in 5 minutes.",
+		"msg * Shutdown cancelled: The scheduled shutdown has been cancelled.",
+	)
+}
+
+func TestPowerScheduleReplacesPendingAction(t *testing.T) {
+	fakeHost(t, "linux")
+	s := NewPowerSchedule()
+	s.SetDelay(50 * time.Millisecond)
+
+	shutdown, restart := make(chan struct{}, 1), make(chan struct{}, 1)
+	_ = s.Schedule("Shutdown", func() error { shutdown <- struct{}{}; return nil })
+	_ = s.Schedule("Restart", func() error { restart <- struct{}{}; return nil })
+
+	select {
+	case <-restart:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replacement action did not run")
+	}
+	select {
+	case <-shutdown:
+		t.Error("replaced action ran")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPowerScheduleEntities(t *testing.T) {
+	fakeHost(t, "linux")
+	previous := powerSchedule
+	powerSchedule = NewPowerSchedule()
+	t.Cleanup(func() { powerSchedule = previous })
+
+	entities := GetPowerScheduleEntities()
+	if len(entities) != 2 {
+		t.Fatalf("got %d entities, want 2", len(entities))
+	}
+	delay, remaining := entities[0], entities[1]
+	if !delay.Retain {
+		t.Error("delay state is not retained")
+	}
+
+	ConfigurePowerDelay(2 * time.Minute)
+	if got, _ := delay.State(); got != 2.0 {
+		t.Errorf("configured delay = %v, want 2", got)
+	}
+
+	if err := delay.Command("abc"); err == nil {
+		t.Error("expected an error for an invalid delay")
+	}
+	if err := delay.Command("5"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, _ := delay.State(); got != 5.0 {
+		t.Errorf("delay = %v, want 5", got)
+	}
+
+	if got, _ := remaining.State(); got != entity.Unknown {
+		t.Errorf("remaining = %v, want unknown", got)
+	}
+	if err := CancelPowerAction(); err == nil {
+		t.Error("expected an error with nothing scheduled")
+	}
+
+	if err := ScheduleShutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer powerSchedule.Cancel()
+	if got, _ := remaining.State(); got != 300.0 {
+		t.Errorf("remaining = %v, want 300", got)
+	}
+	if attributes, _ := remaining.Attributes(); attributes["action"] != "Shutdown" {
+		t.Errorf("attributes = %v, want the Shutdown action", attributes)
+	}
+	if err := CancelPowerAction(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPowerScheduleEntitiesUnsupported(t *testing.T) {
+	fakeHost(t, "plan9")
+
+	if entities := GetPowerScheduleEntities(); len(entities) != 0 {
+		t.Errorf("got %d entities on an unsupported OS, want none", len(entities))
+	}
+}
+
+func TestFormatDelay(t *testing.T) {
+	tests := map[time.Duration]string{
+		30 * time.Second: "30 seconds",
+		time.Minute:      "1 minute",
+		90 * time.Minute: "90 minutes",
+	}
+	for delay, want := range tests {
+		if got := formatDelay(delay); got != want {
+			t.Errorf("formatDelay(%v) = %q, want %q", delay, got, want)
+		}
+	}
+}
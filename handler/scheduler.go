@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/cron"
+	"github.com/timmo001/go-commands/entity"
+)
+
+const (
+	// schedulerInterval is how often schedules are checked for runs that are due
+	schedulerInterval = 15 * time.Second
+	// missedRunGrace is how late a run may start, e.g. after the machine
+	// wakes from sleep, before it is skipped instead
+	missedRunGrace = 5 * time.Minute
+)
+
+// hidIdleTime matches the idle time in nanoseconds in ioreg output on macOS
+var hidIdleTime = regexp.MustCompile(`"HIDIdleTime" = (\d+)`)
+
+// ScheduledCommand runs a registered command whenever its cron expression matches
+type ScheduledCommand struct {
+	// Name is shown in Home Assistant
+	Name string
+	// Category and CommandID identify the command to run
+	Category  string
+	CommandID string
+	// Cron is the cron expression the schedule was parsed from
+	Cron string
+	// Idle skips runs unless the user has been idle for at least this long
+	Idle time.Duration
+
+	schedule *cron.Schedule
+
+	mu         sync.Mutex
+	enabled    bool
+	next       time.Time
+	lastRun    time.Time
+	lastResult string
+
+	// Notifier reports when the schedule runs or is enabled or disabled
+	entity.Notifier
+}
+
+var (
+	schedulesMu sync.RWMutex
+	schedules   []*ScheduledCommand
+)
+
+func init() {
+	entity.Register("schedules", GetScheduleEntities)
+}
+
+// RegisterSchedules registers the scheduled commands from the config file.
+// It returns an error naming any command that is not registered, though
+// those schedules still run if the command is registered later.
+func RegisterSchedules(configs []config.ScheduleConfig) error {
+	var registered []*ScheduledCommand
+	var errs []error
+	for _, cfg := range configs {
+		schedule, err := cron.Parse(cfg.Cron)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %q: %v", cfg.Name, err))
+			continue
+		}
+		category, commandID, _ := strings.Cut(cfg.Command, "/")
+		if _, ok := findCommand(category, commandID); !ok {
+			errs = append(errs, fmt.Errorf("schedule %q: no command %s", cfg.Name, cfg.Command))
+		}
+
+		s := &ScheduledCommand{
+			Name:      cfg.Name,
+			Category:  category,
+			CommandID: commandID,
+			Cron:      cfg.Cron,
+			Idle:      cfg.Idle,
+			schedule:  schedule,
+			enabled:   cfg.Enabled == nil || *cfg.Enabled,
+		}
+		s.next = schedule.Next(time.Now())
+		registered = append(registered, s)
+	}
+
+	schedulesMu.Lock()
+	schedules = registered
+	schedulesMu.Unlock()
+	return errors.Join(errs...)
+}
+
+// Schedules returns every registered scheduled command
+func Schedules() []*ScheduledCommand {
+	schedulesMu.RLock()
+	defer schedulesMu.RUnlock()
+
+	return append([]*ScheduledCommand(nil), schedules...)
+}
+
+// RunSchedules runs scheduled commands as they fall due until stop is closed.
+// It does not depend on the MQTT connection, so schedules keep running while
+// the broker is down.
+func RunSchedules(stop <-chan struct{}) {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			for _, s := range Schedules() {
+				s.check(now)
+			}
+		}
+	}
+}
+
+// SetEnabled enables or disables the schedule
+func (s *ScheduledCommand) SetEnabled(enabled bool) {
+	s.mu.Lock()
+	s.enabled = enabled
+	if enabled {
+		s.next = s.schedule.Next(time.Now())
+	}
+	s.mu.Unlock()
+
+	log.Info("Changed schedule", "schedule", s.Name, "enabled", enabled)
+	s.Notify()
+}
+
+// Enabled reports whether the schedule runs its command
+func (s *ScheduledCommand) Enabled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enabled
+}
+
+// Next returns when the command next runs, or the zero time if the schedule
+// is disabled or never matches again
+func (s *ScheduledCommand) Next() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.enabled {
+		return time.Time{}
+	}
+	return s.next
+}
+
+// check starts the command if a run is due at now, or skips the run if it
+// is too late
+func (s *ScheduledCommand) check(now time.Time) {
+	s.mu.Lock()
+	due := s.enabled && !s.next.IsZero() && !now.Before(s.next)
+	if !due {
+		s.mu.Unlock()
+		return
+	}
+	late := now.Sub(s.next)
+	s.next = s.schedule.Next(now)
+	s.mu.Unlock()
+
+	if late > missedRunGrace {
+		log.Warn("Skipped scheduled command that was missed", "schedule", s.Name, "late", late.Round(time.Second))
+		s.finish(now, fmt.Sprintf("skipped: missed by %v", late.Round(time.Second)))
+		return
+	}
+	go s.run(now)
+}
+
+// run runs the command, unless the user has not been idle for long enough
+func (s *ScheduledCommand) run(now time.Time) {
+	cmd, ok := findCommand(s.Category, s.CommandID)
+	if !ok {
+		log.Error("Scheduled command is not registered", "schedule", s.Name, "category", s.Category, "command", s.CommandID)
+		s.finish(now, fmt.Sprintf("error: no command %s/%s", s.Category, s.CommandID))
+		return
+	}
+
+	if s.Idle > 0 {
+		idle, err := idleTime()
+		if err != nil {
+			log.Warn("Skipped scheduled command, failed to read idle time", "error", err, "schedule", s.Name)
+			s.finish(now, fmt.Sprintf("skipped: %v", err))
+			return
+		}
+		if idle < s.Idle {
+			log.Info("Skipped scheduled command, not idle", "schedule", s.Name, "idle", idle.Round(time.Second))
+			s.finish(now, "skipped: not idle")
+			return
+		}
+	}
+
+	log.Info("Running scheduled command", "schedule", s.Name, "category", s.Category, "command", cmd.Name())
+	if err := cmd.Execute(); err != nil {
+		log.Error("Failed to run scheduled command", "error", err, "schedule", s.Name)
+		s.finish(now, fmt.Sprintf("error: %v", err))
+		return
+	}
+	s.finish(now, "success")
+}
+
+// finish records the outcome of a run
+func (s *ScheduledCommand) finish(now time.Time, result string) {
+	s.mu.Lock()
+	s.lastRun = now
+	s.lastResult = result
+	s.mu.Unlock()
+	s.Notify()
+}
+
+// attributes returns the details of the schedule and its last run
+func (s *ScheduledCommand) attributes() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attributes := map[string]any{
+		"command":     s.Category + "/" + s.CommandID,
+		"cron":        s.Cron,
+		"idle":        nil,
+		"last_run":    nil,
+		"last_result": nil,
+	}
+	if s.Idle > 0 {
+		attributes["idle"] = s.Idle.String()
+	}
+	if !s.lastRun.IsZero() {
+		attributes["last_run"] = s.lastRun.Format(time.RFC3339)
+		attributes["last_result"] = s.lastResult
+	}
+	return attributes
+}
+
+// GetScheduleEntities returns a switch enabling each schedule and a sensor
+// showing when it next runs
+func GetScheduleEntities() []entity.Entity {
+	var entities []entity.Entity
+	for _, s := range Schedules() {
+		id := "schedule_" + entity.ID(s.Name)
+		entities = append(entities,
+			entity.Entity{
+				Component: "switch",
+				ID:        id,
+				Name:      s.Name,
+				Icon:      "mdi:calendar-clock",
+				State: func() (any, error) {
+					return entity.OnOff(s.Enabled()), nil
+				},
+				Command: func(payload string) error {
+					switch payload {
+					case "ON":
+						s.SetEnabled(true)
+					case "OFF":
+						s.SetEnabled(false)
+					default:
+						return fmt.Errorf("invalid schedule state %q, expected ON or OFF", payload)
+					}
+					return nil
+				},
+				Watch: s.Watch,
+			},
+			entity.Entity{
+				Component: "sensor",
+				ID:        id + "_next_run",
+				Name:      s.Name + " Next Run",
+				Icon:      "mdi:calendar-arrow-right",
+				Config:    map[string]any{"device_class": "timestamp"},
+				State: func() (any, error) {
+					next := s.Next()
+					if next.IsZero() {
+						return entity.Unknown, nil
+					}
+					return next.Format(time.RFC3339), nil
+				},
+				Attributes: func() (map[string]any, error) {
+					return s.attributes(), nil
+				},
+				Watch: s.Watch,
+			},
+		)
+	}
+	return entities
+}
+
+// findCommand returns the registered command with an ID in a category
+func findCommand(category, commandID string) (Command, bool) {
+	for _, c := range Categories() {
+		if c.Name != category {
+			continue
+		}
+		for _, cmd := range c.Commands() {
+			if CommandID(cmd.Name()) == commandID {
+				return cmd, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// idleTime returns how long the user has not used the keyboard or mouse
+func idleTime() (time.Duration, error) {
+	switch goos {
+	case "linux":
+		manager := login()
+		if manager == nil {
+			return 0, fmt.Errorf("idle time needs systemd-logind")
+		}
+		since, err := manager.IdleSince()
+		if err != nil || since.IsZero() {
+			return 0, err
+		}
+		return time.Since(since), nil
+	case "darwin":
+		out, err := output("ioreg", "-c", "IOHIDSystem")
+		if err != nil {
+			return 0, fmt.Errorf("failed to read idle time: %v", err)
+		}
+		match := hidIdleTime.FindSubmatch(out)
+		if match == nil {
+			return 0, fmt.Errorf("idle time not found in ioreg output")
+		}
+		nanoseconds, err := strconv.ParseInt(string(match[1]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid idle time %q", match[1])
+		}
+		return time.Duration(nanoseconds), nil
+	default:
+		return 0, fmt.Errorf("idle time not supported on %s", goos)
+	}
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/logind"
+	"github.com/timmo001/go-commands/logind/logindtest"
+)
+
+// registerTestSchedule registers a custom Backup command and one schedule
+// running it, removing both when the test ends
+func registerTestSchedule(t *testing.T, cfg config.ScheduleConfig) *ScheduledCommand {
+	t.Helper()
+
+	RegisterCustomCommands([]config.CommandConfig{{Name: "Backup", Command: []string{"backup.sh"}}})
+	t.Cleanup(func() {
+		RegisterCustomCommands(nil)
+		_ = RegisterSchedules(nil)
+	})
+
+	if err := RegisterSchedules([]config.ScheduleConfig{cfg}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return Schedules()[0]
+}
+
+// waitResult waits for a run of the schedule to finish and returns its result
+func waitResult(t *testing.T, s *ScheduledCommand) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if result := s.attributes()["last_result"]; result != nil {
+			return result.(string)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("scheduled command did not run")
+	return ""
+}
+
+func TestRegisterSchedulesUnknownCommand(t *testing.T) {
+	fakeHost(t, "linux")
+	t.Cleanup(func() { _ = RegisterSchedules(nil) })
+
+	err := RegisterSchedules([]config.ScheduleConfig{
+		{Name: "Lock at Night", Command: "power/lock", Cron: "0 23 * * 1-5"},
+		{Name: "Typo", Command: "power/lcok", Cron: "@daily"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "power/lcok") {
+		t.Errorf("error = %v, want one naming power/lcok", err)
+	}
+	if got := len(Schedules()); got != 2 {
+		t.Errorf("got %d schedules, want 2", got)
+	}
+
+	entities := GetScheduleEntities()
+	if len(entities) != 4 {
+		t.Fatalf("got %d entities, want 4", len(entities))
+	}
+	if e := entities[0]; e.Component != "switch" || e.ID != "schedule_lock_at_night" {
+		t.Errorf("unexpected switch %s %s", e.Component, e.ID)
+	}
+	if e := entities[1]; e.Component != "sensor" || e.ID != "schedule_lock_at_night_next_run" || e.Name != "Lock at Night Next Run" {
+		t.Errorf("unexpected sensor %s %s %q", e.Component, e.ID, e.Name)
+	}
+}
+
+func TestScheduledCommandRuns(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	s := registerTestSchedule(t, config.ScheduleConfig{Name: "Nightly Backup", Command: "custom/backup", Cron: "0 1 * * *"})
+
+	due := s.Next()
+	if due.Hour() != 1 || due.Minute() != 0 || !due.After(time.Now()) {
+		t.Fatalf("next run = %v, want the next 01:00", due)
+	}
+
+	s.check(due.Add(-time.Minute))
+	s.check(due)
+	if got := waitResult(t, s); got != "success" {
+		t.Errorf("result = %q, want success", got)
+	}
+	assertLines(t, recorder, "backup.sh")
+	if next := s.Next(); !next.After(due) {
+		t.Errorf("next run = %v, want after %v", next, due)
+	}
+}
+
+func TestScheduledCommandDisabled(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	disabled := false
+	s := registerTestSchedule(t, config.ScheduleConfig{Name: "Backup", Command: "custom/backup", Cron: "* * * * *", Enabled: &disabled})
+
+	s.check(time.Now().Add(time.Hour))
+	assertLines(t, recorder)
+
+	entities := GetScheduleEntities()
+	if got, _ := entities[0].State(); got != "OFF" {
+		t.Errorf("switch = %v, want OFF", got)
+	}
+	if got, _ := entities[1].State(); got != entity.Unknown {
+		t.Errorf("next run = %v, want unknown while disabled", got)
+	}
+
+	if err := entities[0].Command("ON"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !s.Enabled() || s.Next().IsZero() {
+		t.Error("expected the schedule to be enabled with a next run")
+	}
+	if err := entities[0].Command("MAYBE"); err == nil {
+		t.Error("expected an error for an invalid state")
+	}
+}
+
+func TestScheduledCommandSkipsMissedRun(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	s := registerTestSchedule(t, config.ScheduleConfig{Name: "Backup", Command: "custom/backup", Cron: "0 1 * * *"})
+
+	// The machine was asleep through the run
+	s.check(s.Next().Add(2 * time.Hour))
+	if got := s.attributes()["last_result"]; got == nil || !strings.HasPrefix(got.(string), "skipped: missed") {
+		t.Errorf("result = %v, want a missed run", got)
+	}
+	assertLines(t, recorder)
+}
+
+func TestScheduledCommandIdle(t *testing.T) {
+	tests := map[string]struct {
+		idleSince time.Time
+		want      string
+	}{
+		"idle":     {idleSince: time.Now().Add(-time.Hour), want: "success"},
+		"not idle": {want: "skipped: not idle"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := fakeHost(t, "linux")
+			address := dbustest.NewBus(t)
+			logindtest.NewManager(t, address, logindtest.Session{ID: "2", UID: uint32(os.Getuid()), Active: true, IdleSince: tt.idleSince})
+			client := logind.NewClient(dbustest.Connect(t, address))
+			loginManager = func() (*logind.Client, error) { return client, nil }
+
+			s := registerTestSchedule(t, config.ScheduleConfig{Name: "Backup", Command: "custom/backup", Cron: "* * * * *", Idle: 30 * time.Minute})
+			s.check(s.Next())
+			if got := waitResult(t, s); got != tt.want {
+				t.Errorf("result = %q, want %q", got, tt.want)
+			}
+			if ran := len(recorder.Lines()) == 1; ran != (tt.want == "success") {
+				t.Errorf("commands = %q", recorder.Lines())
+			}
+		})
+	}
+}
+
+func TestIdleTimeOnDarwin(t *testing.T) {
+	recorder := fakeHost(t, "darwin")
+	recorder.Outputs["ioreg -c IOHIDSystem"] = []byte(`    | |   "HIDIdleTime" = 90000000000` + "\n")
+
+	idle, err := idleTime()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if idle != 90*time.Second {
+		t.Errorf("idle = %v, want 90s", idle)
+	}
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/executor"
+)
+
+const (
+	// volumeRestartDelay is how long to wait before watching the sound server
+	// again, doubling each time it stops straight away
+	volumeRestartDelay = 5 * time.Second
+	// volumeMaxRestartDelay is the longest wait before watching again
+	volumeMaxRestartDelay = 5 * time.Minute
+)
+
+// volumePercent matches the first channel's volume in pactl output, e.g. " 50%"
+var volumePercent = regexp.MustCompile(`(\d+)%`)
+
+// volumeEvents shares one watch of the sound server between the volume entities
+type volumeEvents struct {
+	// Notifier reports when the volume or mute state changes
+	entity.Notifier
+
+	mu sync.Mutex
+	// stopWatch stops the watch of the sound server while nothing is watching
+	stopWatch chan struct{}
+}
+
+// volumeWatcher is the watch behind the Volume number and Mute switch
+var volumeWatcher = &volumeEvents{}
+
+func init() {
+	entity.Register("volume", GetVolumeEntities)
+}
+
+// volumeSupported reports whether the volume of the default output can be
+// read, in which case the volume entities replace the mute button
+func volumeSupported() bool {
+	return (goos == "linux" || goos == "darwin") && probeVolume() == nil
+}
+
+// GetVolumeEntities returns the volume number and mute switch for the default output
+func GetVolumeEntities() []entity.Entity {
+	if !volumeSupported() {
+		return nil
+	}
+
+	return []entity.Entity{
+		{
+			Component: "number",
+			ID:        "volume",
+			Name:      "Volume",
+			Icon:      "mdi:volume-high",
+			Config: map[string]any{
+				"min":                 0,
+				"max":                 100,
+				"step":                1,
+				"mode":                "slider",
+				"unit_of_measurement": "%",
+			},
+			State: func() (any, error) { return GetVolume() },
+			Command: func(payload string) error {
+				volume, err := strconv.ParseFloat(strings.TrimSpace(payload), 64)
+				if err != nil || volume < 0 || volume > 100 {
+					return fmt.Errorf("invalid volume %q, expected 0 to 100", payload)
+				}
+				return SetVolume(int(volume))
+			},
+			Watch: volumeWatcher.Watch,
+		},
+		{
+			Component: "switch",
+			ID:        "mute",
+			Name:      "Mute",
+			Icon:      "mdi:volume-mute",
+			State: func() (any, error) {
+				muted, err := GetMute()
+				if err != nil {
+					return nil, err
+				}
+				return entity.OnOff(muted), nil
+			},
+			Command: func(payload string) error {
+				switch payload {
+				case "ON":
+					return SetMute(true)
+				case "OFF":
+					return SetMute(false)
+				default:
+					return fmt.Errorf("invalid mute state %q, expected ON or OFF", payload)
+				}
+			},
+			Watch: volumeWatcher.Watch,
+		},
+	}
+}
+
+// GetVolume returns the volume of the default output as a percentage
+func GetVolume() (int, error) {
+	switch goos {
+	case "linux":
+		// e.g. "Volume: front-left: 32768 /  50% / -18.06 dB,   front-right: ..."
+		out, err := output("pactl", "get-sink-volume", "@DEFAULT_SINK@")
+		if err != nil {
+			return 0, fmt.Errorf("failed to get volume: %v", err)
+		}
+		match := volumePercent.FindStringSubmatch(string(out))
+		if match == nil {
+			return 0, fmt.Errorf("unexpected volume output %q", out)
+		}
+		return strconv.Atoi(match[1])
+	case "darwin":
+		out, err := output("osascript", "-e", "output volume of (get volume settings)")
+		if err != nil {
+			return 0, fmt.Errorf("failed to get volume: %v", err)
+		}
+		volume, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		if err != nil {
+			return 0, fmt.Errorf("unexpected volume output %q", out)
+		}
+		return volume, nil
+	default:
+		return 0, fmt.Errorf("volume control not supported on %s", goos)
+	}
+}
+
+// SetVolume sets the volume of the default output to a percentage
+func SetVolume(volume int) error {
+	switch goos {
+	case "linux":
+		return run("pactl", "set-sink-volume", "@DEFAULT_SINK@", fmt.Sprintf("%d%%", volume))
+	case "darwin":
+		return run("osascript", "-e", fmt.Sprintf("set volume output volume %d", volume))
+	default:
+		return fmt.Errorf("volume control not supported on %s", goos)
+	}
+}
+
+// GetMute reports whether the default output is muted
+func GetMute() (bool, error) {
+	switch goos {
+	case "linux":
+		// e.g. "Mute: yes"
+		out, err := output("pactl", "get-sink-mute", "@DEFAULT_SINK@")
+		if err != nil {
+			return false, fmt.Errorf("failed to get mute state: %v", err)
+		}
+		return strings.Contains(string(out), "yes"), nil
+	case "darwin":
+		out, err := output("osascript", "-e", "output muted of (get volume settings)")
+		if err != nil {
+			return false, fmt.Errorf("failed to get mute state: %v", err)
+		}
+		return strings.TrimSpace(string(out)) == "true", nil
+	default:
+		return false, fmt.Errorf("mute control not supported on %s", goos)
+	}
+}
+
+// SetMute mutes or unmutes the default output
+func SetMute(muted bool) error {
+	switch goos {
+	case "linux":
+		state := "0"
+		if muted {
+			state = "1"
+		}
+		return run("pactl", "set-sink-mute", "@DEFAULT_SINK@", state)
+	case "darwin":
+		return run("osascript", "-e", fmt.Sprintf("set volume output muted %t", muted))
+	default:
+		return fmt.Errorf("mute control not supported on %s", goos)
+	}
+}
+
+// Watch calls changed whenever the volume or mute state changes until stop
+// is closed. The sound server is watched while any entity is watching.
+func (v *volumeEvents) Watch(changed func(), stop <-chan struct{}) {
+	v.mu.Lock()
+	remove := v.AddWatcher(changed)
+	if v.stopWatch == nil {
+		v.stopWatch = make(chan struct{})
+		go watchVolume(v.Notify, v.stopWatch)
+	}
+	v.mu.Unlock()
+
+	<-stop
+
+	v.mu.Lock()
+	remove()
+	if v.Watching() == 0 {
+		close(v.stopWatch)
+		v.stopWatch = nil
+	}
+	v.mu.Unlock()
+}
+
+// watchVolume reports volume and mute changes made on the machine itself.
+// Only Linux reports changes; elsewhere the state is polled.
+func watchVolume(changed func(), stop <-chan struct{}) {
+	if goos != "linux" {
+		return
+	}
+
+	delay := volumeRestartDelay
+	warned := false
+	for {
+		started := time.Now()
+		// e.g. "Event 'change' on sink #52", or "on server" when the default sink changes
+		err := execer.Stream(executor.Command("pactl", "subscribe"), func(line string) {
+			if strings.Contains(line, "'change' on sink #") || strings.Contains(line, "on server") {
+				changed()
+			}
+		}, stop)
+		// The stream ends when stop is closed, e.g. on shutdown, which is not a failure
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		// Start over after a working session, and only warn again after one
+		if time.Since(started) > volumeMaxRestartDelay {
+			delay, warned = volumeRestartDelay, false
+		}
+		if !warned {
+			log.Warn("Sound server events stopped, watching again", "error", err, "delay", delay)
+			warned = true
+		} else {
+			log.Debug("Sound server events stopped, watching again", "error", err, "delay", delay)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, volumeMaxRestartDelay)
+	}
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/executor"
+)
+
+// entityCommand returns the command handler of a volume entity
+func entityCommand(t *testing.T, id string) func(payload string) error {
+	t.Helper()
+
+	for _, e := range GetVolumeEntities() {
+		if e.ID == id {
+			return e.Command
+		}
+	}
+	t.Fatalf("no %s entity", id)
+	return nil
+}
+
+func TestVolumeEntitiesPerOS(t *testing.T) {
+	fakeHost(t, "windows")
+	if entities := GetVolumeEntities(); len(entities) != 0 {
+		t.Errorf("expected no volume entities on windows, got %d", len(entities))
+	}
+	if commands := GetMediaCommands(); commands[len(commands)-1].Name() != "Mute" {
+		t.Error("expected the Mute button on windows")
+	}
+
+	fakeHost(t, "linux")
+	if entities := GetVolumeEntities(); len(entities) != 2 {
+		t.Errorf("got %d volume entities on linux, want 2", len(entities))
+	}
+	for _, cmd := range GetMediaCommands() {
+		if cmd.Name() == "Mute" {
+			t.Error("unexpected Mute button on linux")
+		}
+	}
+}
+
+func TestVolumeEntitiesWithoutSoundServer(t *testing.T) {
+	tests := map[string]func(recorder *executor.Recorder){
+		"no pactl":        func(recorder *executor.Recorder) { recorder.Missing["pactl"] = true },
+		"no sound server": func(recorder *executor.Recorder) { recorder.Errors["pactl info"] = errors.New("connection refused") },
+	}
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			setup(fakeHost(t, "linux"))
+
+			if entities := GetVolumeEntities(); len(entities) != 0 {
+				t.Errorf("got %d volume entities, want none", len(entities))
+			}
+			if commands := GetMediaCommands(); commands[len(commands)-1].Name() != "Mute" {
+				t.Error("expected the Mute button without a sound server")
+			}
+		})
+	}
+}
+
+func TestGetVolumeLinux(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Outputs["pactl get-sink-volume @DEFAULT_SINK@"] = []byte(
+		"Volume: front-left: 42598 /  65% / -11.23 dB,   front-right: 42598 /  65% / -11.23 dB\n        balance 0.00\n")
+	recorder.Outputs["pactl get-sink-mute @DEFAULT_SINK@"] = []byte("Mute: yes\n")
+
+	if volume, err := GetVolume(); err != nil || volume != 65 {
+		t.Errorf("volume = %d, %v, want 65", volume, err)
+	}
+	if muted, err := GetMute(); err != nil || !muted {
+		t.Errorf("muted = %t, %v, want true", muted, err)
+	}
+}
+
+func TestGetVolumeDarwin(t *testing.T) {
+	recorder := fakeHost(t, "darwin")
+	recorder.Outputs["osascript -e output volume of (get volume settings)"] = []byte("31\n")
+	recorder.Outputs["osascript -e output muted of (get volume settings)"] = []byte("false\n")
+
+	if volume, err := GetVolume(); err != nil || volume != 31 {
+		t.Errorf("volume = %d, %v, want 31", volume, err)
+	}
+	if muted, err := GetMute(); err != nil || muted {
+		t.Errorf("muted = %t, %v, want false", muted, err)
+	}
+}
+
+func TestVolumeCommands(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	setVolume, setMute := entityCommand(t, "volume"), entityCommand(t, "mute")
+
+	for _, payload := range []string{"42", "42.0"} {
+		if err := setVolume(payload); err != nil {
+			t.Errorf("set volume %q: unexpected error: %v", payload, err)
+		}
+	}
+	for _, payload := range []string{"-1", "101", "loud"} {
+		if err := setVolume(payload); err == nil {
+			t.Errorf("set volume %q: expected an error", payload)
+		}
+	}
+	if err := setMute("ON"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := setMute("OFF"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := setMute("toggle"); err == nil {
+		t.Error("expected an error for an invalid mute payload")
+	}
+
+	assertLines(t, recorder,
+		"pactl info",
+		"pactl info",
+		"pactl set-sink-volume @DEFAULT_SINK@ 42%",
+		"pactl set-sink-volume @DEFAULT_SINK@ 42%",
+		"pactl set-sink-mute @DEFAULT_SINK@ 1",
+		"pactl set-sink-mute @DEFAULT_SINK@ 0",
+	)
+}
+
+func TestWatchVolume(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Streams["pactl subscribe"] = []string{
+		"Event 'new' on sink-input #80",
+		"Event 'change' on sink #52",
+		"Event 'change' on sink-input #80",
+		"Event 'change' on server #-1",
+	}
+	recorder.Errors["pactl subscribe"] = errors.New("connection terminated")
+
+	changed := make(chan struct{}, 8)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watchVolume(func() { changed <- struct{}{} }, stop)
+		close(done)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-changed:
+		case <-time.After(time.Second):
+			t.Fatalf("got %d changes, want 2", i)
+		}
+	}
+	select {
+	case <-changed:
+		t.Error("unexpected change for a sink input event")
+	default:
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watch did not stop")
+	}
+}
+
+func TestVolumeEntitiesShareWatch(t *testing.T) {
+	recorder := fakeHost(t, "linux")
+	recorder.Streams["pactl subscribe"] = []string{"Event 'change' on sink #52"}
+
+	volume := make(chan struct{}, 8)
+	mute := make(chan struct{}, 8)
+	stop := make(chan struct{})
+	done := make(chan struct{}, 2)
+	watch := func(changes chan struct{}) {
+		volumeWatcher.Watch(func() { changes <- struct{}{} }, stop)
+		done <- struct{}{}
+	}
+
+	go watch(volume)
+	select {
+	case <-volume:
+	case <-time.After(time.Second):
+		t.Fatal("no change reported")
+	}
+	go watch(mute)
+	for volumeWatcher.Watching() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The second entity uses the running watch rather than starting another
+	if calls := recorder.Calls(); len(calls) != 1 {
+		t.Errorf("got %d pactl subscribe processes, want 1", len(calls))
+	}
+	volumeWatcher.Notify()
+	if len(mute) != 1 {
+		t.Error("the mute switch was not told about the change")
+	}
+
+	close(stop)
+	<-done
+	<-done
+	volumeWatcher.mu.Lock()
+	defer volumeWatcher.mu.Unlock()
+	if volumeWatcher.stopWatch != nil {
+		t.Error("the sound server is still watched after every entity stopped watching")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/timmo001/go-commands/utils"
+)
+
+// invalidClientIDChars matches characters some brokers reject in client IDs
+var invalidClientIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// identity is how this machine is named in MQTT and Home Assistant
+type identity struct {
+	DeviceName string
+	UniqueID   string
+	BaseTopic  string
+	ClientID   string
+}
+
+// identityFromEnv derives the identity from the hostname and machine ID,
+// allowing each part to be overridden with environment variables
+func identityFromEnv() identity {
+	hostname := utils.GetHostname()
+
+	id := identity{
+		DeviceName: os.Getenv("DEVICE_NAME"),
+		UniqueID:   os.Getenv("UNIQUE_ID"),
+		BaseTopic:  os.Getenv("BASE_TOPIC"),
+		ClientID:   os.Getenv("MQTT_CLIENT_ID"),
+	}
+	if id.DeviceName == "" {
+		id.DeviceName = fmt.Sprintf("Go Commands - %s", hostname)
+	}
+	if id.UniqueID == "" {
+		id.UniqueID = fmt.Sprintf("go_commands_%s", hostname)
+	}
+	if id.BaseTopic == "" {
+		id.BaseTopic = fmt.Sprintf("go-commands/%s", id.UniqueID)
+	}
+	id.BaseTopic = strings.TrimSuffix(id.BaseTopic, "/")
+	if id.ClientID == "" {
+		id.ClientID = stableClientID(hostname, utils.GetMachineID())
+	}
+	return id
+}
+
+// stableClientID builds a client ID that stays the same across restarts and
+// differs between machines that share a hostname
+func stableClientID(hostname, machineID string) string {
+	clientID := "go-commands-" + invalidClientIDChars.ReplaceAllString(hostname, "-")
+	if machineID != "" {
+		// Hash the machine ID, which should not be exposed to the network
+		sum := sha256.Sum256([]byte(machineID))
+		clientID += "-" + hex.EncodeToString(sum[:])[:8]
+	}
+	return clientID
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStableClientID(t *testing.T) {
+	first := stableClientID("desktop", "0123456789abcdef")
+	if first != stableClientID("desktop", "0123456789abcdef") {
+		t.Error("client ID changed between calls")
+	}
+	if !strings.HasPrefix(first, "go-commands-desktop-") {
+		t.Errorf("client ID = %q, want the hostname in it", first)
+	}
+	if strings.Contains(first, "0123456789abcdef") {
+		t.Errorf("client ID %q exposes the machine ID", first)
+	}
+	if first == stableClientID("desktop", "fedcba9876543210") {
+		t.Error("machines sharing a hostname got the same client ID")
+	}
+	if got := stableClientID("my.host name", ""); got != "go-commands-my-host-name" {
+		t.Errorf("client ID = %q, want go-commands-my-host-name", got)
+	}
+}
+
+func TestIdentityFromEnvOverrides(t *testing.T) {
+	t.Setenv("DEVICE_NAME", "Office PC")
+	t.Setenv("UNIQUE_ID", "office_pc")
+	t.Setenv("BASE_TOPIC", "")
+	t.Setenv("MQTT_CLIENT_ID", "office-pc")
+
+	id := identityFromEnv()
+
+	want := identity{
+		DeviceName: "Office PC",
+		UniqueID:   "office_pc",
+		BaseTopic:  "go-commands/office_pc",
+		ClientID:   "office-pc",
+	}
+	if id != want {
+		t.Errorf("identity = %+v, want %+v", id, want)
+	}
+}
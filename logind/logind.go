@@ -0,0 +1,191 @@
+package logind
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// BusName is the bus name of systemd-logind
+	BusName = "org.freedesktop.login1"
+	// ManagerPath is the object of the logind manager
+	ManagerPath = dbus.ObjectPath("/org/freedesktop/login1")
+	// ManagerInterface holds the power and session methods
+	ManagerInterface = "org.freedesktop.login1.Manager"
+	// SessionInterface holds the methods of a login session
+	SessionInterface = "org.freedesktop.login1.Session"
+)
+
+// Power actions, named after their logind methods
+const (
+	PowerOff             = "PowerOff"
+	Reboot               = "Reboot"
+	Suspend              = "Suspend"
+	Hibernate            = "Hibernate"
+	HybridSleep          = "HybridSleep"
+	SuspendThenHibernate = "SuspendThenHibernate"
+)
+
+// Inhibitor lock types
+const (
+	// InhibitIdle stops the session going idle, e.g. blanking or locking the screen
+	InhibitIdle = "idle"
+	// InhibitSleep stops the system suspending or hibernating
+	InhibitSleep = "sleep"
+)
+
+// Client talks to systemd-logind on the system bus
+type Client struct {
+	conn *dbus.Conn
+}
+
+// Connect connects to the system bus and checks that logind is running
+func Connect() (*Client, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to system bus: %v", err)
+	}
+
+	client := NewClient(conn)
+	var hasOwner bool
+	if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, BusName).Store(&hasOwner); err != nil || !hasOwner {
+		conn.Close()
+		return nil, fmt.Errorf("logind is not running")
+	}
+	return client, nil
+}
+
+// NewClient creates a Client using an existing bus connection
+func NewClient(conn *dbus.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Close closes the bus connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Can returns whether a power action is available: yes, no, challenge if it
+// needs authorization, or na if the hardware does not support it
+func (c *Client) Can(action string) (string, error) {
+	var result string
+	if err := c.manager().Call(ManagerInterface+".Can"+action, 0).Store(&result); err != nil {
+		return "", fmt.Errorf("failed to check %s: %v", action, err)
+	}
+	return result, nil
+}
+
+// Supported reports whether a power action can be used without authorization,
+// as Do never asks for it
+func (c *Client) Supported(action string) bool {
+	result, err := c.Can(action)
+	return err == nil && result == "yes"
+}
+
+// Do performs a power action without asking for authorization interactively
+func (c *Client) Do(action string) error {
+	if err := c.manager().Call(ManagerInterface+"."+action, 0, false).Err; err != nil {
+		return fmt.Errorf("failed to %s: %v", action, err)
+	}
+	return nil
+}
+
+// LockSession locks the session of the user running this process
+func (c *Client) LockSession() error {
+	session, err := c.session()
+	if err != nil {
+		return err
+	}
+	if err := c.conn.Object(BusName, session).Call(SessionInterface+".Lock", 0).Err; err != nil {
+		return fmt.Errorf("failed to lock session: %v", err)
+	}
+	return nil
+}
+
+// Inhibitor is an inhibitor lock held until it is closed
+type Inhibitor struct {
+	file *os.File
+}
+
+// Inhibit takes a blocking inhibitor lock on what, a colon separated list of
+// lock types such as "idle:sleep". Who and why are shown to the user.
+func (c *Client) Inhibit(what, who, why string) (*Inhibitor, error) {
+	var fd dbus.UnixFD
+	if err := c.manager().Call(ManagerInterface+".Inhibit", 0, what, who, why, "block").Store(&fd); err != nil {
+		return nil, fmt.Errorf("failed to inhibit %s: %v", what, err)
+	}
+	return &Inhibitor{file: os.NewFile(uintptr(fd), "inhibitor")}, nil
+}
+
+// Close releases the inhibitor lock
+func (i *Inhibitor) Close() error {
+	return i.file.Close()
+}
+
+// IdleSince returns when the session of the user running this process became
+// idle, or the zero time if it is in use
+func (c *Client) IdleSince() (time.Time, error) {
+	session, err := c.session()
+	if err != nil {
+		return time.Time{}, err
+	}
+	object := c.conn.Object(BusName, session)
+
+	idle, err := object.GetProperty(SessionInterface + ".IdleHint")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read idle hint: %v", err)
+	}
+	if idle.Value() != true {
+		return time.Time{}, nil
+	}
+
+	// IdleSinceHint is in microseconds since the Unix epoch
+	since, err := object.GetProperty(SessionInterface + ".IdleSinceHint")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read idle time: %v", err)
+	}
+	micros, ok := since.Value().(uint64)
+	if !ok {
+		return time.Time{}, fmt.Errorf("unexpected idle time %v", since)
+	}
+	return time.UnixMicro(int64(micros)), nil
+}
+
+// session returns the login session of this process or, when running as a
+// service outside a session, the user's active session
+func (c *Client) session() (dbus.ObjectPath, error) {
+	var path dbus.ObjectPath
+	if err := c.manager().Call(ManagerInterface+".GetSessionByPID", 0, uint32(os.Getpid())).Store(&path); err == nil {
+		return path, nil
+	}
+
+	var sessions []struct {
+		ID   string
+		UID  uint32
+		User string
+		Seat string
+		Path dbus.ObjectPath
+	}
+	if err := c.manager().Call(ManagerInterface+".ListSessions", 0).Store(&sessions); err != nil {
+		return "", fmt.Errorf("failed to list sessions: %v", err)
+	}
+
+	uid := uint32(os.Getuid())
+	for _, session := range sessions {
+		if session.UID != uid {
+			continue
+		}
+		active, err := c.conn.Object(BusName, session.Path).GetProperty(SessionInterface + ".Active")
+		if err == nil && active.Value() == true {
+			return session.Path, nil
+		}
+	}
+	return "", fmt.Errorf("no active session for user %d", uid)
+}
+
+func (c *Client) manager() dbus.BusObject {
+	return c.conn.Object(BusName, ManagerPath)
+}
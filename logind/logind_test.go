@@ -0,0 +1,124 @@
+package logind_test
+
+import (
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/logind"
+	"github.com/timmo001/go-commands/logind/logindtest"
+)
+
+func TestCapabilities(t *testing.T) {
+	address := dbustest.NewBus(t)
+	manager := logindtest.NewManager(t, address)
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	manager.SetCapability(logind.Hibernate, "na")
+	manager.SetCapability(logind.HybridSleep, "no")
+	manager.SetCapability(logind.Reboot, "challenge")
+
+	tests := map[string]bool{
+		logind.PowerOff:    true,
+		logind.Reboot:      false,
+		logind.Hibernate:   false,
+		logind.HybridSleep: false,
+	}
+	for action, want := range tests {
+		if got := client.Supported(action); got != want {
+			t.Errorf("Supported(%s) = %t, want %t", action, got, want)
+		}
+	}
+	if result, err := client.Can(logind.Hibernate); err != nil || result != "na" {
+		t.Errorf("Can(Hibernate) = %q, %v", result, err)
+	}
+}
+
+func TestDoAndLockSession(t *testing.T) {
+	address := dbustest.NewBus(t)
+	uid := uint32(os.Getuid())
+	manager := logindtest.NewManager(t, address,
+		logindtest.Session{ID: "1", UID: uid + 1, Active: true},
+		logindtest.Session{ID: "2", UID: uid, Active: false},
+		logindtest.Session{ID: "3", UID: uid, Active: true},
+	)
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	if err := client.Do(logind.Suspend); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := client.LockSession(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only the user's active session is locked
+	if calls := manager.Calls(); !slices.Equal(calls, []string{"Suspend", "Lock 3"}) {
+		t.Errorf("calls = %v", calls)
+	}
+}
+
+func TestLockSessionWithoutSession(t *testing.T) {
+	address := dbustest.NewBus(t)
+	logindtest.NewManager(t, address, logindtest.Session{ID: "1", UID: uint32(os.Getuid()) + 1, Active: true})
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	if err := client.LockSession(); err == nil {
+		t.Error("expected an error without a session for the user")
+	}
+}
+
+func TestIdleSince(t *testing.T) {
+	address := dbustest.NewBus(t)
+	uid := uint32(os.Getuid())
+	since := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+	logindtest.NewManager(t, address, logindtest.Session{ID: "1", UID: uid, Active: true, IdleSince: since})
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	got, err := client.IdleSince()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.Equal(since) {
+		t.Errorf("IdleSince = %v, want %v", got, since)
+	}
+}
+
+func TestIdleSinceInUse(t *testing.T) {
+	address := dbustest.NewBus(t)
+	logindtest.NewManager(t, address, logindtest.Session{ID: "1", UID: uint32(os.Getuid()), Active: true})
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	got, err := client.IdleSince()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.IsZero() {
+		t.Errorf("IdleSince = %v, want the zero time while in use", got)
+	}
+}
+
+func TestInhibit(t *testing.T) {
+	address := dbustest.NewBus(t)
+	manager := logindtest.NewManager(t, address)
+	client := logind.NewClient(dbustest.Connect(t, address))
+
+	inhibitor, err := client.Inhibit(logind.InhibitIdle+":"+logind.InhibitSleep, "Test", "Testing")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := manager.Calls(); !slices.Equal(calls, []string{"Inhibit idle:sleep block"}) {
+		t.Errorf("calls = %v", calls)
+	}
+	if manager.Released(0, 500*time.Millisecond) {
+		t.Fatal("inhibitor released while held")
+	}
+
+	if err := inhibitor.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !manager.Released(0, 5*time.Second) {
+		t.Error("inhibitor not released after closing")
+	}
+}
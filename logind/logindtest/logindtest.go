@@ -0,0 +1,167 @@
+// Package logindtest provides a stand-in systemd-logind for tests
+package logindtest
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/logind"
+)
+
+// Session is a login session offered by the stand-in logind
+type Session struct {
+	ID     string
+	UID    uint32
+	Active bool
+	// IdleSince is when the session became idle, or zero if it is in use
+	IdleSince time.Time
+}
+
+// Manager is a stand-in logind that records the methods called on it
+type Manager struct {
+	mu           sync.Mutex
+	capabilities map[string]string
+	calls        []string
+	inhibitors   []*os.File
+}
+
+// listedSession is a session as returned by ListSessions
+type listedSession struct {
+	ID   string
+	UID  uint32
+	User string
+	Seat string
+	Path dbus.ObjectPath
+}
+
+// NewManager exports a stand-in logind on the bus with the given sessions
+func NewManager(t testing.TB, address string, sessions ...Session) *Manager {
+	t.Helper()
+
+	m := &Manager{capabilities: map[string]string{}}
+	conn := dbustest.Connect(t, address)
+
+	methods := map[string]any{
+		"GetSessionByPID": func(pid uint32) (dbus.ObjectPath, *dbus.Error) {
+			// Like a user service, the caller is not part of a session
+			return "", dbus.NewError("org.freedesktop.login1.NoSessionForPID", []any{"not in a session"})
+		},
+		"Inhibit": func(what, who, why, mode string) (dbus.UnixFD, *dbus.Error) {
+			// The caller holds the write end, so the read end sees EOF once it is released
+			r, w, err := os.Pipe()
+			if err != nil {
+				return 0, dbus.MakeFailedError(err)
+			}
+			m.record("Inhibit " + what + " " + mode)
+			m.mu.Lock()
+			m.inhibitors = append(m.inhibitors, r)
+			m.mu.Unlock()
+			fd := dbus.UnixFD(w.Fd())
+			// The reply duplicates the descriptor, so this copy can be closed once it is sent
+			time.AfterFunc(250*time.Millisecond, func() { w.Close() })
+			return fd, nil
+		},
+		"ListSessions": func() ([]listedSession, *dbus.Error) {
+			var result []listedSession
+			for _, s := range sessions {
+				result = append(result, listedSession{s.ID, s.UID, "user", "seat0", sessionPath(s.ID)})
+			}
+			return result, nil
+		},
+	}
+	for _, action := range []string{logind.PowerOff, logind.Reboot, logind.Suspend, logind.Hibernate, logind.HybridSleep, logind.SuspendThenHibernate} {
+		methods["Can"+action] = func() (string, *dbus.Error) {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if result, ok := m.capabilities[action]; ok {
+				return result, nil
+			}
+			return "yes", nil
+		}
+		methods[action] = func(interactive bool) *dbus.Error {
+			m.record(action)
+			return nil
+		}
+	}
+	if err := conn.ExportMethodTable(methods, logind.ManagerPath, logind.ManagerInterface); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range sessions {
+		id := s.ID
+		path := sessionPath(id)
+		err := conn.ExportMethodTable(map[string]any{
+			"Lock": func() *dbus.Error {
+				m.record("Lock " + id)
+				return nil
+			},
+		}, path, logind.SessionInterface)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var idleSince uint64
+		if !s.IdleSince.IsZero() {
+			idleSince = uint64(s.IdleSince.UnixMicro())
+		}
+		_, err = prop.Export(conn, path, prop.Map{
+			logind.SessionInterface: {
+				"Active":        {Value: s.Active, Emit: prop.EmitFalse},
+				"IdleHint":      {Value: !s.IdleSince.IsZero(), Emit: prop.EmitFalse},
+				"IdleSinceHint": {Value: idleSince, Emit: prop.EmitFalse},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbustest.Own(t, conn, logind.BusName)
+	return m
+}
+
+// SetCapability sets the result of the Can* method for an action, e.g. na.
+// Actions that are not set return yes.
+func (m *Manager) SetCapability(action, result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.capabilities[action] = result
+}
+
+// Released reports whether the caller has closed the inhibitor lock taken
+// by the nth call to Inhibit, waiting up to timeout for it
+func (m *Manager) Released(n int, timeout time.Duration) bool {
+	m.mu.Lock()
+	r := m.inhibitors[n]
+	m.mu.Unlock()
+
+	_ = r.SetReadDeadline(time.Now().Add(timeout))
+	_, err := r.Read(make([]byte, 1))
+	return errors.Is(err, io.EOF)
+}
+
+// Calls returns the actions and session locks requested so far
+func (m *Manager) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]string(nil), m.calls...)
+}
+
+func (m *Manager) record(call string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.calls = append(m.calls, call)
+}
+
+func sessionPath(id string) dbus.ObjectPath {
+	return dbus.ObjectPath("/org/freedesktop/login1/session/_" + id)
+}
@@ -1,53 +1,96 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/charmbracelet/log"
-	mqtt_paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/joho/godotenv"
+	"github.com/timmo001/go-commands/config"
+	"github.com/timmo001/go-commands/entity"
 	"github.com/timmo001/go-commands/handler"
 	"github.com/timmo001/go-commands/mqtt"
-	"github.com/timmo001/go-commands/utils"
+	_ "github.com/timmo001/go-commands/sensors"
 )
 
-func init() {
+func main() {
 	log.SetLevel(log.DebugLevel)
 
+	purgeEntities := flag.Bool("purge", false, "Remove all of this host's entities from Home Assistant and exit")
+	flag.Parse()
+
 	// Load .env file
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file", "error", err)
 	}
-}
 
-func main() {
-	// Get MQTT configuration from environment variables
-	mqttHost := os.Getenv("MQTT_HOST")
-	mqttPort := os.Getenv("MQTT_PORT")
-	mqttUser := os.Getenv("MQTT_USER")
-	mqttPassword := os.Getenv("MQTT_PASSWORD")
+	// Load the config file and register user-defined commands
+	cfg, err := config.Load(config.Path())
+	if err != nil {
+		log.Fatal("Failed to load config file", "error", err)
+	}
+	handler.RegisterCustomCommands(cfg.Commands)
+	for command, window := range cfg.Confirm {
+		category, id, _ := strings.Cut(command, "/")
+		if err := handler.RequireConfirmation(category, id, window); err != nil {
+			log.Warn("Confirmation configured for an unknown command", "error", err)
+		}
+	}
+	handler.ConfigurePowerDelay(cfg.PowerDelay)
+	handler.ConfigureKeepAwake(cfg.KeepAwake)
+	if err := handler.ConfigureClipboard(cfg.Clipboard); err != nil {
+		log.Warn("Invalid clipboard settings", "error", err)
+	}
+	if err := handler.RegisterSchedules(cfg.Schedules); err != nil {
+		log.Warn("Schedule configured for an unknown command", "error", err)
+	}
 
-	// Create MQTT broker URL
-	brokerURL := fmt.Sprintf("tcp://%s:%s", mqttHost, mqttPort)
+	id := identityFromEnv()
+	deviceName := id.DeviceName
+	uniqueID := id.UniqueID
+	baseTopic := id.BaseTopic
+
+	// Load the entities published by the previous run
+	manifest, err := mqtt.LoadManifest(manifestPathFromEnv())
+	if err != nil {
+		log.Fatal("Failed to load manifest", "error", err)
+	}
+
+	mqttConfig := mqttConfigFromEnv(id.ClientID, fmt.Sprintf("%s/availability", baseTopic))
+	mqttConfig.CommandMaxAge = cfg.CommandMaxAge
+	if *purgeEntities {
+		purge(mqttConfig, uniqueID, manifest)
+		return
+	}
 
 	// Create a new MQTT client
-	client := mqtt.NewClient(brokerURL, mqttUser, mqttPassword)
+	client, err := mqtt.NewClient(mqttConfig)
+	if err != nil {
+		log.Fatal("Failed to create MQTT client", "error", err)
+	}
 
-	// Connect to the broker
-	if err := client.Connect(); err != nil {
+	// Run scheduled commands, whether or not the broker is connected
+	stopSchedules := make(chan struct{})
+	go handler.RunSchedules(stopSchedules)
+	defer close(stopSchedules)
+
+	// Connect to the broker. If it is down, keep going and let the client
+	// retry, so schedules still run and everything is published once it is up.
+	if err := client.Connect(); errors.Is(err, mqtt.ErrRetrying) {
+		log.Error("Failed to connect to MQTT broker", "error", err)
+	} else if err != nil {
 		log.Fatal("Failed to connect to MQTT broker", "error", err)
 	}
 	defer client.Disconnect()
 
-	hostname := utils.GetHostname()
-	deviceName := fmt.Sprintf("Go Commands - %s", hostname)
-	uniqueID := fmt.Sprintf("go_commands_%s", hostname)
-	baseTopic := fmt.Sprintf("go-commands/%s", uniqueID)
-
 	device := map[string]interface{}{
 		"identifiers":  []string{uniqueID},
 		"name":         deviceName,
@@ -66,74 +109,65 @@ func main() {
 	}
 
 	// Publish discovery configuration for status sensor
-	err := client.PublishDiscovery("sensor", uniqueID, "status", sensorConfig)
+	err = client.PublishDiscovery("sensor", uniqueID, "status", sensorConfig)
 	if err != nil {
 		log.Error("Failed to publish discovery message", "error", err)
 	}
 
-	// Get all power commands
-	powerCommands := handler.GetPowerCommands()
-
-	// Publish discovery configuration for each power command button
-	for _, cmd := range powerCommands {
-		nameAsId, buttonConfig := handler.GetButtonConfig(device, uniqueID, baseTopic, cmd)
-		err := client.PublishDiscovery("button", uniqueID, fmt.Sprintf("power_%s", nameAsId), buttonConfig)
-		if err != nil {
-			log.Error("Failed to publish button discovery message", "error", err, "command", cmd.Name)
-		}
-
-		// Subscribe to the command topic
-		commandTopic := fmt.Sprintf("%s/power/%s", baseTopic, nameAsId)
-		err = client.Subscribe(commandTopic, 1, func(client mqtt_paho.Client, msg mqtt_paho.Message) {
-			log.Info("Executing power command", "command", cmd.Name)
-			if err := cmd.Handler(); err != nil {
-				log.Error("Failed to execute power command", "error", err, "command", cmd.Name)
-			}
-		})
-		if err != nil {
-			log.Error("Failed to subscribe to command topic", "error", err, "command", cmd.Name)
+	// Publish discovery configuration and subscribe for every registered
+	// command, probing them again whenever Home Assistant restarts
+	showUnsupported := cfg.UnsupportedCommands == config.UnsupportedShow
+	publishCommands := func() {
+		for _, category := range handler.Categories() {
+			registerCommands(client, device, uniqueID, baseTopic, category, showUnsupported)
 		}
 	}
+	publishCommands()
+	client.OnRediscover(publishCommands)
 
-	// Get all media commands
-	mediaCommands := handler.GetMediaCommands()
+	// Publish every registered entity and keep their states up to date
+	entities := entity.NewManager(client, device, uniqueID, baseTopic, cfg.Sensors.Interval)
+	entities.Start()
+	defer entities.Stop()
+	defer handler.ReleaseKeepAwake()
 
-	// Publish discovery configuration for each media command button
-	for _, cmd := range mediaCommands {
-		nameAsId, buttonConfig := handler.GetMediaButtonConfig(device, uniqueID, baseTopic, cmd)
-		err := client.PublishDiscovery("button", uniqueID, fmt.Sprintf("media_%s", nameAsId), buttonConfig)
-		if err != nil {
-			log.Error("Failed to publish button discovery message", "error", err, "command", cmd.Name)
-		}
+	// Remove entities published by a previous run that no longer exist, then
+	// keep the manifest up to date as entities come and go. Until the cleanup
+	// works, e.g. while the broker is down, the previous run's topics are kept.
+	var manifestMu sync.Mutex
+	cleaned := false
+	updateManifest := func() {
+		manifestMu.Lock()
+		defer manifestMu.Unlock()
 
-		// Subscribe to the command topic
-		commandTopic := fmt.Sprintf("%s/media/%s", baseTopic, nameAsId)
-		err = client.Subscribe(commandTopic, 1, func(client mqtt_paho.Client, msg mqtt_paho.Message) {
-			log.Info("Executing media command", "command", cmd.Name)
-			if err := cmd.Handler(); err != nil {
-				log.Error("Failed to execute media command", "error", err, "command", cmd.Name)
+		if !cleaned {
+			if err := mqtt.CleanupStale(client, manifest); err != nil {
+				log.Error("Failed to remove stale entities", "error", err)
+				return
 			}
-		})
-		if err != nil {
-			log.Error("Failed to subscribe to command topic", "error", err, "command", cmd.Name)
+			cleaned = true
+		}
+		if err := manifest.Record(client.DiscoveryTopics()); err != nil {
+			log.Error("Failed to save manifest", "error", err)
 		}
 	}
-
-	// Publish initial availability
-	err = client.Publish(fmt.Sprintf("%s/availability", baseTopic), 1, true, "online")
-	if err != nil {
-		log.Error("Failed to publish availability", "error", err)
-	}
+	updateManifest()
+	defer updateManifest()
 
 	// Start publishing status periodically
+	publishStatus := func() {
+		err := client.PublishState(fmt.Sprintf("%s/status", baseTopic), "online")
+		if err != nil {
+			log.Error("Failed to publish status", "error", err)
+		}
+	}
+	publishStatus()
 	ticker := time.NewTicker(30 * time.Second)
 	go func() {
 		for {
 			<-ticker.C
-			err := client.Publish(fmt.Sprintf("%s/status", baseTopic), 1, false, "online")
-			if err != nil {
-				log.Error("Failed to publish status", "error", err)
-			}
+			publishStatus()
+			updateManifest()
 		}
 	}()
 
@@ -144,11 +178,97 @@ func main() {
 	// Block until signal is received
 	<-sigChan
 
-	// Publish offline status before exiting
-	err = client.Publish(fmt.Sprintf("%s/availability", baseTopic), 1, true, "offline")
-	if err != nil {
-		log.Error("Failed to publish offline status", "error", err)
+	log.Info("Shutting down...")
+}
+
+// registerCommands probes each command in a category, publishes a button for
+// it and subscribes to its command topic. Commands that cannot run on this
+// machine are left out, or published as unavailable when showUnsupported is set.
+func registerCommands(client mqtt.Client, device map[string]interface{}, uniqueID, baseTopic string, category handler.Category, showUnsupported bool) {
+	for _, cmd := range category.Commands() {
+		nameAsId, buttonConfig := handler.GetButtonConfig(device, uniqueID, baseTopic, category.Name, cmd)
+		objectID := fmt.Sprintf("%s_%s", category.Name, nameAsId)
+		commandTopic := handler.CommandTopic(baseTopic, category.Name, nameAsId)
+
+		probeErr := handler.Probe(cmd)
+		if probeErr != nil {
+			log.Warn("Command is not supported on this machine", "reason", probeErr, "category", category.Name, "command", cmd.Name())
+			if !showUnsupported {
+				// Remove the button if the command worked when it was published
+				topic := mqtt.DiscoveryTopic("button", uniqueID, objectID)
+				if slices.Contains(client.DiscoveryTopics(), topic) {
+					if err := client.ClearDiscovery(topic); err != nil {
+						log.Error("Failed to remove button", "error", err, "category", category.Name, "command", cmd.Name())
+					}
+				}
+				continue
+			}
+		}
+
+		if showUnsupported {
+			addSupportTopics(buttonConfig, commandTopic)
+		}
+		err := client.PublishDiscovery("button", uniqueID, objectID, buttonConfig)
+		if err != nil {
+			log.Error("Failed to publish button discovery message", "error", err, "category", category.Name, "command", cmd.Name())
+		}
+		if showUnsupported {
+			publishSupport(client, commandTopic, probeErr)
+		}
+
+		// Subscribe to the command topic
+		confirmation := handler.ConfirmationFor(category.Name, nameAsId)
+		err = client.SubscribeCommand(commandTopic, func(msg mqtt.Message) error {
+			// An empty message clears the topic rather than pressing the button
+			if len(msg.Payload) == 0 {
+				return nil
+			}
+			// The subscription outlives the button if the command stops working
+			if err := handler.Probe(cmd); err != nil {
+				log.Warn("Ignoring command that is not supported on this machine", "reason", err, "category", category.Name, "command", cmd.Name())
+				return fmt.Errorf("command is not supported on this machine: %v", err)
+			}
+			if confirmation != nil && !confirmation.Press() {
+				log.Warn("Command armed, press again to run it", "window", confirmation.Window, "category", category.Name, "command", cmd.Name())
+				return fmt.Errorf("armed, press again within %v to run it", confirmation.Window)
+			}
+
+			log.Info("Executing command", "category", category.Name, "command", cmd.Name())
+			err := cmd.Execute()
+			if err != nil {
+				log.Error("Failed to execute command", "error", err, "category", category.Name, "command", cmd.Name())
+			}
+			return err
+		})
+		if err != nil {
+			log.Error("Failed to subscribe to command topic", "error", err, "category", category.Name, "command", cmd.Name())
+		}
 	}
+}
 
-	log.Info("Shutting down...")
+// addSupportTopics makes a button's availability also depend on whether its
+// command can run, and adds the reason it cannot as an attribute
+func addSupportTopics(buttonConfig map[string]any, commandTopic string) {
+	buttonConfig["availability"] = []map[string]any{
+		{"topic": buttonConfig["availability_topic"]},
+		{"topic": commandTopic + "/supported"},
+	}
+	buttonConfig["availability_mode"] = "all"
+	delete(buttonConfig, "availability_topic")
+	buttonConfig["json_attributes_topic"] = commandTopic + "/attributes"
+}
+
+// publishSupport publishes whether a command can run and, if not, the reason
+func publishSupport(client mqtt.Client, commandTopic string, probeErr error) {
+	supported, attributes := mqtt.PayloadOnline, map[string]any{"reason": nil}
+	if probeErr != nil {
+		supported, attributes = mqtt.PayloadOffline, map[string]any{"reason": probeErr.Error()}
+	}
+
+	if err := client.PublishState(commandTopic+"/supported", supported); err != nil {
+		log.Error("Failed to publish command support", "error", err, "topic", commandTopic)
+	}
+	if err := client.PublishState(commandTopic+"/attributes", attributes); err != nil {
+		log.Error("Failed to publish command attributes", "error", err, "topic", commandTopic)
+	}
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/handler"
+	"github.com/timmo001/go-commands/mqtt"
+)
+
+// fakeClient records the discovery configs, states and subscriptions published
+type fakeClient struct {
+	discovery map[string]map[string]any
+	states    map[string]any
+	handlers  map[string]mqtt.MessageHandler
+}
+
+func newFakeClient() *fakeClient {
+	return &fakeClient{
+		discovery: map[string]map[string]any{},
+		states:    map[string]any{},
+		handlers:  map[string]mqtt.MessageHandler{},
+	}
+}
+
+func (c *fakeClient) Connect() error                                { return nil }
+func (c *fakeClient) Disconnect()                                   {}
+func (c *fakeClient) Publish(string, byte, bool, interface{}) error { return nil }
+func (c *fakeClient) IsConnected() bool                             { return true }
+func (c *fakeClient) OnRediscover(func())                           {}
+
+func (c *fakeClient) PublishDiscovery(component, nodeID, objectID string, config interface{}) error {
+	c.discovery[mqtt.DiscoveryTopic(component, nodeID, objectID)] = config.(map[string]any)
+	return nil
+}
+
+func (c *fakeClient) DiscoveryTopics() []string {
+	var topics []string
+	for topic := range c.discovery {
+		topics = append(topics, topic)
+	}
+	slices.Sort(topics)
+	return topics
+}
+
+func (c *fakeClient) ClearDiscovery(topic string) error {
+	delete(c.discovery, topic)
+	return nil
+}
+
+func (c *fakeClient) PublishState(topic string, payload interface{}) error {
+	c.states[topic] = payload
+	return nil
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) error {
+	c.handlers[topic] = callback
+	return nil
+}
+
+func (c *fakeClient) SubscribeCommand(topic string, callback mqtt.MessageHandler) error {
+	return c.Subscribe(topic, 1, callback)
+}
+
+// testCategory has one command that works and one that does not
+func testCategory(supported *bool) handler.Category {
+	return handler.Category{
+		Name: "test",
+		Commands: func() []handler.Command {
+			return []handler.Command{
+				handler.NewCommand("Works", "mdi:check", "", func() error { return nil }),
+				handler.NewProbedCommand("Flaky", "mdi:close", "", func() error { return nil }, func() error {
+					if *supported {
+						return nil
+					}
+					return errors.New("flaky is not installed")
+				}),
+			}
+		},
+	}
+}
+
+func TestRegisterCommandsHidesUnsupported(t *testing.T) {
+	client := newFakeClient()
+	supported := true
+	category := testCategory(&supported)
+
+	registerCommands(client, map[string]any{}, "node", "base", category, false)
+	if got := len(client.DiscoveryTopics()); got != 2 {
+		t.Fatalf("published %d buttons, want 2", got)
+	}
+
+	// Probing again on rediscovery removes the button that stopped working
+	supported = false
+	registerCommands(client, map[string]any{}, "node", "base", category, false)
+	want := []string{"homeassistant/button/node/test_works/config"}
+	if got := client.DiscoveryTopics(); !slices.Equal(got, want) {
+		t.Errorf("buttons = %q, want %q", got, want)
+	}
+
+	// A late press on the removed button's topic does not run the command
+	if err := client.handlers["base/test/flaky"](mqtt.Message{Payload: []byte("PRESS")}); err == nil {
+		t.Error("expected an error pressing a command that stopped working")
+	}
+}
+
+func TestRegisterCommandsShowsUnsupported(t *testing.T) {
+	client := newFakeClient()
+	supported := false
+
+	registerCommands(client, map[string]any{}, "node", "base", testCategory(&supported), true)
+
+	config := client.discovery["homeassistant/button/node/test_flaky/config"]
+	if config == nil {
+		t.Fatal("unsupported command was not published")
+	}
+	if config["json_attributes_topic"] != "base/test/flaky/attributes" || config["availability_mode"] != "all" {
+		t.Errorf("unexpected config: %v", config)
+	}
+	if got := client.states["base/test/flaky/supported"]; got != mqtt.PayloadOffline {
+		t.Errorf("supported = %v, want offline", got)
+	}
+	if got := client.states["base/test/flaky/attributes"].(map[string]any)["reason"]; got != "flaky is not installed" {
+		t.Errorf("reason = %v", got)
+	}
+	if got := client.states["base/test/works/supported"]; got != mqtt.PayloadOnline {
+		t.Errorf("supported = %v, want online", got)
+	}
+}
+
+func TestRegisterCommandsWithConfirmation(t *testing.T) {
+	client := newFakeClient()
+	runs := 0
+	category := handler.Category{
+		Name: "confirm",
+		Commands: func() []handler.Command {
+			return []handler.Command{
+				handler.NewCommand("Shutdown", "mdi:power", "", func() error {
+					runs++
+					return nil
+				}),
+			}
+		},
+	}
+	handler.Register(category.Name, category.Commands)
+	if err := handler.RequireConfirmation("confirm", "shutdown", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	registerCommands(client, map[string]any{}, "node", "base", category, false)
+	press := client.handlers["base/confirm/shutdown"]
+
+	// An empty message neither arms nor runs the command
+	if err := press(mqtt.Message{}); err != nil || runs != 0 || handler.ConfirmationFor("confirm", "shutdown").Armed() {
+		t.Fatalf("empty message ran the command %d times, error %v", runs, err)
+	}
+
+	// The first press reports that it only armed the command
+	message := mqtt.Message{Payload: []byte("PRESS")}
+	if err := press(message); err == nil || runs != 0 {
+		t.Fatalf("first press ran the command %d times, error %v", runs, err)
+	}
+	if err := press(message); err != nil || runs != 1 {
+		t.Fatalf("second press ran the command %d times, error %v", runs, err)
+	}
+}
@@ -0,0 +1,249 @@
+package mpris
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// BusPrefix is the prefix of every MPRIS player's bus name
+	BusPrefix = "org.mpris.MediaPlayer2."
+	// ObjectPath is the object every MPRIS player exports
+	ObjectPath = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	// RootInterface holds the player's identity
+	RootInterface = "org.mpris.MediaPlayer2"
+	// PlayerInterface holds the playback methods and properties
+	PlayerInterface = "org.mpris.MediaPlayer2.Player"
+	// Playerctld is the bus name of playerctld, which proxies the most recently active player
+	Playerctld = BusPrefix + "playerctld"
+	// PlayerctldInterface lists the players playerctld knows about, most recently active first
+	PlayerctldInterface = "com.github.altdesktop.playerctld"
+)
+
+// Status is what a player is playing
+type Status struct {
+	// Player is the player's bus name
+	Player string
+	// Identity is the player's display name, e.g. Spotify
+	Identity string
+	// PlaybackStatus is Playing, Paused or Stopped
+	PlaybackStatus string
+	Title          string
+	Artists        []string
+	Album          string
+	ArtURL         string
+	Position       time.Duration
+	Length         time.Duration
+}
+
+// Client talks to MPRIS players on a session bus
+type Client struct {
+	conn *dbus.Conn
+}
+
+// Connect connects to the session bus
+func Connect() (*Client, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %v", err)
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient creates a Client using an existing bus connection
+func NewClient(conn *dbus.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Close closes the bus connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Players returns the bus names of the running players, excluding playerctld
+func (c *Client) Players() ([]string, error) {
+	var names []string
+	if err := c.conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		return nil, fmt.Errorf("failed to list bus names: %v", err)
+	}
+
+	var players []string
+	for _, name := range names {
+		if strings.HasPrefix(name, BusPrefix) && name != Playerctld {
+			players = append(players, name)
+		}
+	}
+	sort.Strings(players)
+	return players, nil
+}
+
+// ActivePlayer returns the selected player while it is running. Otherwise it
+// returns the player that is playing or, if none are, the most recently active
+// player according to playerctld when that is running, or else the first
+// player. It returns "" when no players are running.
+func (c *Client) ActivePlayer() (string, error) {
+	players, err := c.Players()
+	if err != nil || len(players) == 0 {
+		return "", err
+	}
+	if selected := SelectedPlayer(); slices.Contains(players, selected) {
+		return selected, nil
+	}
+	for _, player := range players {
+		var status string
+		if err := c.property(player, PlayerInterface, "PlaybackStatus", &status); err == nil && status == "Playing" {
+			return player, nil
+		}
+	}
+
+	var recent []string
+	if err := c.property(Playerctld, PlayerctldInterface, "PlayerNames", &recent); err == nil {
+		for _, name := range recent {
+			if slices.Contains(players, name) {
+				return name, nil
+			}
+		}
+	}
+
+	return players[0], nil
+}
+
+// Call calls a playback method without arguments on a player, e.g. PlayPause
+func (c *Client) Call(player, method string) error {
+	if err := c.conn.Object(player, ObjectPath).Call(PlayerInterface+"."+method, 0).Err; err != nil {
+		return fmt.Errorf("failed to call %s on %s: %v", method, player, err)
+	}
+	return nil
+}
+
+// Status returns what a player is playing
+func (c *Client) Status(player string) (Status, error) {
+	status := Status{Player: player}
+
+	var props map[string]dbus.Variant
+	err := c.conn.Object(player, ObjectPath).Call("org.freedesktop.DBus.Properties.GetAll", 0, PlayerInterface).Store(&props)
+	if err != nil {
+		return status, fmt.Errorf("failed to read %s properties: %v", player, err)
+	}
+
+	// Identity is optional, fall back to the bus name
+	if err := c.property(player, RootInterface, "Identity", &status.Identity); err != nil {
+		status.Identity = strings.TrimPrefix(player, BusPrefix)
+	}
+
+	status.PlaybackStatus, _ = props["PlaybackStatus"].Value().(string)
+	status.Position = microseconds(props["Position"].Value())
+
+	metadata, _ := props["Metadata"].Value().(map[string]dbus.Variant)
+	status.Title, _ = metadata["xesam:title"].Value().(string)
+	status.Artists, _ = metadata["xesam:artist"].Value().([]string)
+	status.Album, _ = metadata["xesam:album"].Value().(string)
+	status.ArtURL, _ = metadata["mpris:artUrl"].Value().(string)
+	status.Length = microseconds(metadata["mpris:length"].Value())
+
+	return status, nil
+}
+
+// Watch blocks until stop is closed, calling changed whenever a player's
+// properties change, it seeks, a player starts or exits, or another player is selected
+func (c *Client) Watch(changed func(), stop <-chan struct{}) error {
+	matches := [][]dbus.MatchOption{
+		{
+			dbus.WithMatchObjectPath(ObjectPath),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		},
+		{
+			dbus.WithMatchObjectPath(ObjectPath),
+			dbus.WithMatchInterface(PlayerInterface),
+			dbus.WithMatchMember("Seeked"),
+		},
+		{
+			dbus.WithMatchSender("org.freedesktop.DBus"),
+			dbus.WithMatchMember("NameOwnerChanged"),
+			dbus.WithMatchArg0Namespace(strings.TrimSuffix(BusPrefix, ".")),
+		},
+	}
+	for _, match := range matches {
+		if err := c.conn.AddMatchSignal(match...); err != nil {
+			return fmt.Errorf("failed to watch players: %v", err)
+		}
+		defer c.conn.RemoveMatchSignal(match...)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	selection, unwatch := watchSelection()
+	defer unwatch()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-selection:
+			changed()
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("session bus connection closed")
+			}
+			// The connection delivers every signal to every channel, so
+			// ignore those that another watcher asked for
+			if isPlayerSignal(signal) {
+				changed()
+			}
+		}
+	}
+}
+
+// isPlayerSignal reports whether a signal is about an MPRIS player
+func isPlayerSignal(signal *dbus.Signal) bool {
+	switch signal.Name {
+	case "org.freedesktop.DBus.Properties.PropertiesChanged":
+		if signal.Path != ObjectPath || len(signal.Body) == 0 {
+			return false
+		}
+		iface, _ := signal.Body[0].(string)
+		return iface == PlayerInterface || iface == RootInterface
+	case PlayerInterface + ".Seeked":
+		return signal.Path == ObjectPath
+	case "org.freedesktop.DBus.NameOwnerChanged":
+		if len(signal.Body) == 0 {
+			return false
+		}
+		name, _ := signal.Body[0].(string)
+		return strings.HasPrefix(name, BusPrefix)
+	}
+	return false
+}
+
+// property reads a single property of a player
+func (c *Client) property(player, iface, name string, value any) error {
+	variant, err := c.conn.Object(player, ObjectPath).GetProperty(iface + "." + name)
+	if err != nil {
+		return err
+	}
+	return variant.Store(value)
+}
+
+// microseconds converts an MPRIS time value, which players send as either a
+// signed or unsigned integer
+func microseconds(value any) time.Duration {
+	switch v := value.(type) {
+	case int64:
+		return time.Duration(v) * time.Microsecond
+	case uint64:
+		return time.Duration(v) * time.Microsecond
+	case int32:
+		return time.Duration(v) * time.Microsecond
+	case uint32:
+		return time.Duration(v) * time.Microsecond
+	}
+	return 0
+}
@@ -0,0 +1,176 @@
+package mpris_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/mpris"
+	"github.com/timmo001/go-commands/mpris/mpristest"
+)
+
+func TestPlayersAndStatus(t *testing.T) {
+	address := mpristest.NewBus(t)
+	client := mpris.NewClient(mpristest.Connect(t, address))
+
+	mpristest.NewPlayer(t, address, "mpv", "mpv")
+	spotify := mpristest.NewPlayer(t, address, "spotify", "Spotify")
+
+	players, err := client.Players()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"org.mpris.MediaPlayer2.mpv", "org.mpris.MediaPlayer2.spotify"}
+	if !slices.Equal(players, want) {
+		t.Errorf("players = %v, want %v", players, want)
+	}
+
+	// Without a playing player the first one is active
+	if active, _ := client.ActivePlayer(); active != want[0] {
+		t.Errorf("active player = %q, want %q", active, want[0])
+	}
+
+	spotify.Set("PlaybackStatus", "Playing")
+	spotify.Set("Position", int64(30_000_000))
+	spotify.SetTrack("Song", []string{"Artist A", "Artist B"}, "Album", 180_000_000)
+
+	if active, _ := client.ActivePlayer(); active != want[1] {
+		t.Errorf("active player = %q, want %q", active, want[1])
+	}
+
+	status, err := client.Status(want[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status.Identity != "Spotify" || status.PlaybackStatus != "Playing" || status.Title != "Song" || status.Album != "Album" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	if !slices.Equal(status.Artists, []string{"Artist A", "Artist B"}) {
+		t.Errorf("artists = %v", status.Artists)
+	}
+	if status.Position != 30*time.Second || status.Length != 3*time.Minute {
+		t.Errorf("position = %v, length = %v", status.Position, status.Length)
+	}
+}
+
+func TestActivePlayerUsesPlayerctld(t *testing.T) {
+	address := mpristest.NewBus(t)
+	client := mpris.NewClient(mpristest.Connect(t, address))
+
+	if active, err := client.ActivePlayer(); err != nil || active != "" {
+		t.Errorf("active player without players = %q, %v", active, err)
+	}
+
+	mpristest.NewPlayer(t, address, "mpv", "mpv")
+	mpristest.NewPlayer(t, address, "spotify", "Spotify")
+	mpristest.NewPlayerctld(t, address, "org.mpris.MediaPlayer2.firefox", "org.mpris.MediaPlayer2.spotify")
+
+	if players, _ := client.Players(); len(players) != 2 {
+		t.Errorf("players = %v, want playerctld left out", players)
+	}
+
+	// firefox has exited, so the most recent running player is spotify
+	if active, _ := client.ActivePlayer(); active != "org.mpris.MediaPlayer2.spotify" {
+		t.Errorf("active player = %q, want spotify", active)
+	}
+}
+
+func TestCall(t *testing.T) {
+	address := mpristest.NewBus(t)
+	client := mpris.NewClient(mpristest.Connect(t, address))
+	player := mpristest.NewPlayer(t, address, "mpv", "mpv")
+
+	for _, method := range []string{"PlayPause", "Next"} {
+		if err := client.Call("org.mpris.MediaPlayer2.mpv", method); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if calls := player.Calls(); !slices.Equal(calls, []string{"PlayPause", "Next"}) {
+		t.Errorf("calls = %v", calls)
+	}
+
+	if err := client.Call("org.mpris.MediaPlayer2.vlc", "Next"); err == nil {
+		t.Error("expected an error calling a missing player")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	address := mpristest.NewBus(t)
+	client := mpris.NewClient(mpristest.Connect(t, address))
+
+	changed := make(chan struct{}, 16)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- client.Watch(func() { changed <- struct{}{} }, stop)
+	}()
+
+	expectChange := func(what string) {
+		t.Helper()
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change reported after %s", what)
+		}
+	}
+
+	// Wait for the watch to be registered by starting players until one is seen
+	var player *mpristest.Player
+	deadline := time.After(5 * time.Second)
+	for player == nil {
+		p := mpristest.NewPlayer(t, address, "vlc", "VLC")
+		select {
+		case <-changed:
+			player = p
+		case <-time.After(100 * time.Millisecond):
+			p.Close()
+		case <-deadline:
+			t.Fatal("watch never reported a player starting")
+		}
+	}
+
+	// Drop changes from players closed while waiting
+	drain := func() {
+		for {
+			select {
+			case <-changed:
+			default:
+				return
+			}
+		}
+	}
+
+	drain()
+	player.Set("PlaybackStatus", "Playing")
+	expectChange("playback status changed")
+
+	drain()
+	player.Close()
+	expectChange("player exited")
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSelectedPlayer(t *testing.T) {
+	address := mpristest.NewBus(t)
+	client := mpris.NewClient(mpristest.Connect(t, address))
+	t.Cleanup(func() { mpris.SelectPlayer("") })
+
+	mpristest.NewPlayer(t, address, "mpv", "mpv")
+	spotify := mpristest.NewPlayer(t, address, "spotify", "Spotify")
+	spotify.Set("PlaybackStatus", "Playing")
+
+	mpris.SelectPlayer("org.mpris.MediaPlayer2.mpv")
+	if active, _ := client.ActivePlayer(); active != "org.mpris.MediaPlayer2.mpv" {
+		t.Errorf("active player = %q, want the selected mpv", active)
+	}
+
+	// A selected player that is not running is ignored
+	mpris.SelectPlayer("org.mpris.MediaPlayer2.vlc")
+	if active, _ := client.ActivePlayer(); active != "org.mpris.MediaPlayer2.spotify" {
+		t.Errorf("active player = %q, want the playing spotify", active)
+	}
+}
@@ -0,0 +1,140 @@
+// Package mpristest provides a private session bus and stand-in MPRIS
+// players for tests
+package mpristest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/mpris"
+)
+
+// NewBus starts a private session bus for the test and points
+// DBUS_SESSION_BUS_ADDRESS at it. The test is skipped if dbus-daemon is not installed.
+func NewBus(t testing.TB) string {
+	t.Helper()
+
+	address := dbustest.NewBus(t)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	return address
+}
+
+// Connect opens a connection to the bus for the test
+func Connect(t testing.TB, address string) *dbus.Conn {
+	t.Helper()
+
+	return dbustest.Connect(t, address)
+}
+
+// Player is a stand-in MPRIS player that records the methods called on it
+type Player struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// NewPlayer exports a stopped player named org.mpris.MediaPlayer2.<name> on the bus
+func NewPlayer(t testing.TB, address, name, identity string) *Player {
+	t.Helper()
+
+	p := &Player{conn: Connect(t, address)}
+	if err := p.conn.Export(p, mpris.ObjectPath, mpris.PlayerInterface); err != nil {
+		t.Fatal(err)
+	}
+
+	props, err := prop.Export(p.conn, mpris.ObjectPath, prop.Map{
+		mpris.RootInterface: {
+			"Identity": {Value: identity, Emit: prop.EmitTrue},
+		},
+		mpris.PlayerInterface: {
+			"PlaybackStatus": {Value: "Stopped", Emit: prop.EmitTrue},
+			"Metadata":       {Value: map[string]dbus.Variant{}, Emit: prop.EmitTrue},
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"Volume":         {Value: 1.0, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.props = props
+
+	dbustest.Own(t, p.conn, mpris.BusPrefix+name)
+	return p
+}
+
+// NewPlayerctld exports a stand-in playerctld reporting players as most recently active first
+func NewPlayerctld(t testing.TB, address string, players ...string) {
+	t.Helper()
+
+	conn := Connect(t, address)
+	_, err := prop.Export(conn, mpris.ObjectPath, prop.Map{
+		mpris.PlayerctldInterface: {
+			"PlayerNames": {Value: players, Emit: prop.EmitTrue},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbustest.Own(t, conn, mpris.Playerctld)
+}
+
+// Set changes a player property and emits PropertiesChanged
+func (p *Player) Set(property string, value any) {
+	p.props.SetMust(mpris.PlayerInterface, property, value)
+}
+
+// SetTrack changes the metadata of the current track
+func (p *Player) SetTrack(title string, artists []string, album string, lengthMicros int64) {
+	p.Set("Metadata", map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath("/org/mpris/MediaPlayer2/Track/1")),
+		"xesam:title":   dbus.MakeVariant(title),
+		"xesam:artist":  dbus.MakeVariant(artists),
+		"xesam:album":   dbus.MakeVariant(album),
+		"mpris:length":  dbus.MakeVariant(lengthMicros),
+	})
+}
+
+// Close removes the player from the bus
+func (p *Player) Close() {
+	p.conn.Close()
+}
+
+// Calls returns the names of the methods called on the player
+func (p *Player) Calls() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.calls...)
+}
+
+func (p *Player) record(method string) *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls = append(p.calls, method)
+	return nil
+}
+
+// PlayPause implements the MPRIS method
+func (p *Player) PlayPause() *dbus.Error { return p.record("PlayPause") }
+
+// Play implements the MPRIS method
+func (p *Player) Play() *dbus.Error { return p.record("Play") }
+
+// Pause implements the MPRIS method
+func (p *Player) Pause() *dbus.Error { return p.record("Pause") }
+
+// Stop implements the MPRIS method
+func (p *Player) Stop() *dbus.Error { return p.record("Stop") }
+
+// Next implements the MPRIS method
+func (p *Player) Next() *dbus.Error { return p.record("Next") }
+
+// Previous implements the MPRIS method
+func (p *Player) Previous() *dbus.Error { return p.record("Previous") }
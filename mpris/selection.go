@@ -0,0 +1,53 @@
+package mpris
+
+import "sync"
+
+var (
+	selectionMu sync.Mutex
+	selected    string
+	// selectionWatchers are notified when the selected player changes
+	selectionWatchers = map[chan struct{}]bool{}
+)
+
+// SelectPlayer sets the player that media commands and the now playing
+// sensor use while it is running. An empty name selects automatically.
+func SelectPlayer(player string) {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+
+	if player == selected {
+		return
+	}
+	selected = player
+	for watcher := range selectionWatchers {
+		// A pending notification already covers this change
+		select {
+		case watcher <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// SelectedPlayer returns the selected player, or "" when selecting automatically
+func SelectedPlayer() string {
+	selectionMu.Lock()
+	defer selectionMu.Unlock()
+
+	return selected
+}
+
+// watchSelection returns a channel that receives when the selected player
+// changes, and a function to stop watching
+func watchSelection() (<-chan struct{}, func()) {
+	watcher := make(chan struct{}, 1)
+
+	selectionMu.Lock()
+	selectionWatchers[watcher] = true
+	selectionMu.Unlock()
+
+	return watcher, func() {
+		selectionMu.Lock()
+		delete(selectionWatchers, watcher)
+		selectionMu.Unlock()
+	}
+}
@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// testBroker is an in-process MQTT broker for tests
+type testBroker struct {
+	*mqttserver.Server
+	addr string
+	once sync.Once
+}
+
+// freeAddr returns a local address with a port that is currently unused
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// startBroker starts a broker listening on addr with an empty session store
+func startBroker(t *testing.T, addr string) *testBroker {
+	t.Helper()
+	return startBrokerWithListener(t, addr, listeners.Config{ID: "tcp", Address: addr})
+}
+
+func startBrokerWithListener(t *testing.T, addr string, config listeners.Config) *testBroker {
+	t.Helper()
+
+	server := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.AddListener(listeners.NewTCP(config)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &testBroker{Server: server, addr: addr}
+	t.Cleanup(broker.stop)
+	return broker
+}
+
+// stop closes the broker, it is safe to call more than once
+func (b *testBroker) stop() {
+	b.once.Do(func() { b.Close() })
+}
+
+// retained returns the retained payload on a topic
+func (b *testBroker) retained(topic string) (string, bool) {
+	messages := b.Topics.Messages(topic)
+	if len(messages) == 0 {
+		return "", false
+	}
+	return string(messages[0].Payload), true
+}
+
+// waitRetained waits until the retained payload on a topic equals want
+func (b *testBroker) waitRetained(t *testing.T, topic, want string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, _ := b.retained(topic)
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("retained payload on %s = %q, want %q", topic, got, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// eventually polls condition until it holds or the test times out
+func eventually(t *testing.T, condition func() bool, message string) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal(message)
+}
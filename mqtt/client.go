@@ -2,119 +2,161 @@ package mqtt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
+)
+
+const (
+	// PayloadOnline is published to the availability topic while connected
+	PayloadOnline = "online"
+	// PayloadOffline is published to the availability topic when disconnected
+	PayloadOffline = "offline"
+	// DefaultBirthTopic is where Home Assistant announces that it has started
+	DefaultBirthTopic = "homeassistant/status"
 
-	"github.com/charmbracelet/log"
-	MQTT "github.com/eclipse/paho.mqtt.golang"
+	// discoveryPrefix is the topic prefix Home Assistant watches for discovery configs
+	discoveryPrefix = "homeassistant"
 )
 
-// Client represents an MQTT client instance
-type Client struct {
-	client    MQTT.Client
-	brokerURL string
-	username  string
-	password  string
-	clientID  string
-	connected bool
+// ErrRetrying is wrapped by the error Connect returns when the first
+// connection attempt fails. The client keeps trying in the background and
+// replays everything published or subscribed meanwhile once it connects.
+var ErrRetrying = errors.New("retrying in the background")
+
+// Config holds the settings used to connect to the MQTT broker
+type Config struct {
+	BrokerURL string
+	Username  string
+	Password  string
+	// ProtocolVersion selects the MQTT protocol, 3 (3.1.1, default) or 5
+	ProtocolVersion int
+	// ClientID identifies the session to the broker and should be stable
+	// across restarts. A unique ID is generated if empty.
+	ClientID string
+	// PersistentSession keeps the session on the broker while disconnected,
+	// so QoS 1 messages sent meanwhile are delivered on reconnect
+	PersistentSession bool
+	// AvailabilityTopic receives a retained online/offline payload. The broker
+	// publishes offline as the Last Will if the connection drops unexpectedly.
+	AvailabilityTopic string
+	// BirthTopic is where Home Assistant publishes online when it starts.
+	// Discovery, availability and states are republished when it does.
+	// Defaults to DefaultBirthTopic.
+	BirthTopic string
+	// TLS configures ssl:// and wss:// connections
+	TLS TLSConfig
+	// CommandMaxAge drops command messages whose payload has a timestamp
+	// older than this. Zero accepts messages of any age.
+	CommandMaxAge time.Duration
 }
 
-// NewClient creates a new MQTT client instance
-func NewClient(brokerURL, username, password string) *Client {
-	return &Client{
-		brokerURL: brokerURL,
-		username:  username,
-		password:  password,
-		clientID:  fmt.Sprintf("go-commands-%d", time.Now().Unix()),
-	}
+// Client represents an MQTT client instance
+type Client interface {
+	// Connect establishes connection to the MQTT broker. If the broker cannot
+	// be reached, the returned error wraps ErrRetrying.
+	Connect() error
+	// Disconnect publishes offline availability and cleanly disconnects from the MQTT broker
+	Disconnect()
+	// Publish sends a message to a specific topic with QoS
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+	// PublishDiscovery publishes a Home Assistant discovery message.
+	// The config is remembered and republished after every reconnect.
+	PublishDiscovery(component, nodeID, objectID string, config interface{}) error
+	// DiscoveryTopics returns the topic of every discovery config published so far
+	DiscoveryTopics() []string
+	// ClearDiscovery removes the retained discovery config on a topic, which
+	// deletes the entity from Home Assistant, and stops republishing it
+	ClearDiscovery(topic string) error
+	// PublishState publishes a state payload to a topic. The latest state is
+	// remembered and republished after a reconnect or when Home Assistant restarts.
+	PublishState(topic string, payload interface{}) error
+	// Subscribe subscribes to a topic with specified QoS and message handler.
+	// The subscription is remembered and restored after every reconnect.
+	Subscribe(topic string, qos byte, callback MessageHandler) error
+	// SubscribeCommand subscribes to a topic that triggers an action. Retained
+	// messages are cleared from the broker and ignored, as are the messages
+	// that clear them and messages older than CommandMaxAge.
+	SubscribeCommand(topic string, callback MessageHandler) error
+	// IsConnected returns the current connection status
+	IsConnected() bool
+	// OnRediscover registers a callback that runs when Home Assistant
+	// restarts, before the remembered discovery configs are republished
+	OnRediscover(callback func())
 }
 
-// Connect establishes connection to the MQTT broker
-func (c *Client) Connect() error {
-	opts := MQTT.NewClientOptions()
-	opts.AddBroker(c.brokerURL)
-	opts.SetClientID(c.clientID)
-	opts.SetUsername(c.username)
-	opts.SetPassword(c.password)
-	opts.SetAutoReconnect(true)
-	opts.SetOnConnectHandler(c.onConnect)
-	opts.SetConnectionLostHandler(c.onConnectionLost)
+// Message is a message received on a subscribed topic
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+	// ResponseTopic and CorrelationData are only set by MQTT v5 requests
+	ResponseTopic   string
+	CorrelationData []byte
+}
 
-	c.client = MQTT.NewClient(opts)
-	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %v", token.Error())
-	}
+// MessageHandler handles a message received on a subscribed topic. With MQTT
+// v5, the result is sent as a Response if the message has a response topic.
+type MessageHandler func(msg Message) error
 
-	return nil
+// Response is published to the response topic of an MQTT v5 request
+type Response struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
 }
 
-// Disconnect cleanly disconnects from the MQTT broker
-func (c *Client) Disconnect() {
-	if c.client != nil && c.client.IsConnected() {
-		c.client.Disconnect(250)
+// NewResponse creates the Response for the result of handling a request
+func NewResponse(err error) Response {
+	if err != nil {
+		return Response{Success: false, Error: err.Error()}
 	}
+	return Response{Success: true}
 }
 
-// Publish sends a message to a specific topic with QoS
-func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
-	if !c.client.IsConnected() {
-		return fmt.Errorf("client is not connected")
+// NewClient creates a new MQTT client instance for the configured protocol version
+func NewClient(cfg Config) (Client, error) {
+	if cfg.BirthTopic == "" {
+		cfg.BirthTopic = DefaultBirthTopic
 	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("go-commands-%d", time.Now().UnixNano())
+	}
+
+	switch cfg.ProtocolVersion {
+	case 0, 3, 4:
+		return newV3Client(cfg, clientID), nil
+	case 5:
+		return newV5Client(cfg, clientID), nil
+	default:
+		return nil, fmt.Errorf("unsupported MQTT protocol version %d", cfg.ProtocolVersion)
+	}
+}
 
-	var payloadBytes []byte
+// encodePayload converts a payload to bytes, marshalling anything other than
+// a string or byte slice to JSON
+func encodePayload(payload interface{}) ([]byte, error) {
 	switch p := payload.(type) {
 	case string:
-		payloadBytes = []byte(p)
+		return []byte(p), nil
 	case []byte:
-		payloadBytes = p
+		return p, nil
 	default:
-		var err error
-		payloadBytes, err = json.Marshal(p)
+		payloadBytes, err := json.Marshal(p)
 		if err != nil {
-			return fmt.Errorf("failed to marshal payload: %v", err)
+			return nil, fmt.Errorf("failed to marshal payload: %v", err)
 		}
+		return payloadBytes, nil
 	}
-
-	token := c.client.Publish(topic, qos, retained, payloadBytes)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish message: %v", token.Error())
-	}
-
-	log.Info("Published message", "topic", topic, "payload", payload)
-
-	return nil
-}
-
-// PublishDiscovery publishes a Home Assistant discovery message
-func (c *Client) PublishDiscovery(component, nodeID, objectID string, config interface{}) error {
-	topic := fmt.Sprintf("homeassistant/%s/%s/%s/config", component, nodeID, objectID)
-	err := c.Publish(topic, 1, true, config)
-	if err == nil {
-		log.Info("Published discovery message", "topic", topic)
-	}
-	return err
 }
 
-// Subscribe subscribes to a topic with specified QoS and message handler
-func (c *Client) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) error {
-	if token := c.client.Subscribe(topic, qos, callback); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to subscribe to topic: %v", token.Error())
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
-	log.Info("Subscribed to topic", "topic", topic)
-	return nil
-}
-
-func (c *Client) onConnect(client MQTT.Client) {
-	c.connected = true
-	log.Info("Connected to MQTT broker", "broker", c.brokerURL)
-}
-
-func (c *Client) onConnectionLost(client MQTT.Client, err error) {
-	c.connected = false
-	log.Error("Lost connection to MQTT broker", "error", err)
-}
-
-// IsConnected returns the current connection status
-func (c *Client) IsConnected() bool {
-	return c.connected && c.client.IsConnected()
+	sort.Strings(keys)
+	return keys
 }
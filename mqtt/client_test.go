@@ -0,0 +1,329 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// protocolVersions are the MQTT versions every client test runs against
+var protocolVersions = []int{3, 5}
+
+// forEachVersion runs a test against a client for each protocol version
+func forEachVersion(t *testing.T, test func(t *testing.T, version int)) {
+	for _, version := range protocolVersions {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			test(t, version)
+		})
+	}
+}
+
+func newTestClient(t *testing.T, cfg Config) Client {
+	t.Helper()
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestNewClientRejectsUnknownVersion(t *testing.T) {
+	if _, err := NewClient(Config{ProtocolVersion: 6}); err == nil {
+		t.Fatal("expected an error for protocol version 6")
+	}
+}
+
+func TestClientRestoresSessionAfterBrokerRestart(t *testing.T) {
+	forEachVersion(t, func(t *testing.T, version int) {
+		addr := freeAddr(t)
+		broker := startBroker(t, addr)
+
+		client := newTestClient(t, Config{
+			BrokerURL:         "tcp://" + addr,
+			ProtocolVersion:   version,
+			AvailabilityTopic: "test/availability",
+		})
+		if err := client.Connect(); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer client.Disconnect()
+
+		var received atomic.Int32
+		err := client.Subscribe("test/command", 1, func(Message) error {
+			received.Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+
+		discoveryTopic := "homeassistant/button/node/object/config"
+		if err := client.PublishDiscovery("button", "node", "object", map[string]string{"name": "Test"}); err != nil {
+			t.Fatalf("failed to publish discovery: %v", err)
+		}
+		broker.waitRetained(t, discoveryTopic, `{"name":"Test"}`)
+		broker.waitRetained(t, "test/availability", PayloadOnline)
+
+		// Restart the broker, losing every session and retained message
+		broker.stop()
+		eventually(t, func() bool { return !client.IsConnected() }, "client did not notice the broker stopping")
+		broker = startBroker(t, addr)
+
+		eventually(t, client.IsConnected, "client did not reconnect")
+		broker.waitRetained(t, discoveryTopic, `{"name":"Test"}`)
+		broker.waitRetained(t, "test/availability", PayloadOnline)
+
+		eventually(t, func() bool {
+			if err := broker.Publish("test/command", []byte("PRESS"), false, 1); err != nil {
+				t.Fatal(err)
+			}
+			return received.Load() > 0
+		}, "command subscription was not restored after reconnect")
+	})
+}
+
+func TestClientRetriesFirstConnection(t *testing.T) {
+	forEachVersion(t, func(t *testing.T, version int) {
+		addr := freeAddr(t)
+
+		client := newTestClient(t, Config{
+			BrokerURL:         "tcp://" + addr,
+			ProtocolVersion:   version,
+			AvailabilityTopic: "test/availability",
+		})
+		err := client.Connect()
+		if !errors.Is(err, ErrRetrying) {
+			t.Fatalf("Connect() = %v, want an error wrapping ErrRetrying", err)
+		}
+		defer client.Disconnect()
+
+		if err := client.PublishDiscovery("button", "node", "object", map[string]string{"name": "Test"}); err != nil {
+			t.Fatalf("failed to queue discovery: %v", err)
+		}
+
+		broker := startBroker(t, addr)
+		eventually(t, client.IsConnected, "client did not connect once the broker started")
+		broker.waitRetained(t, "homeassistant/button/node/object/config", `{"name":"Test"}`)
+		broker.waitRetained(t, "test/availability", PayloadOnline)
+	})
+}
+
+func TestClientPublishesOfflineOnDisconnect(t *testing.T) {
+	forEachVersion(t, func(t *testing.T, version int) {
+		addr := freeAddr(t)
+		broker := startBroker(t, addr)
+
+		client := newTestClient(t, Config{
+			BrokerURL:         "tcp://" + addr,
+			ProtocolVersion:   version,
+			AvailabilityTopic: "test/availability",
+		})
+		if err := client.Connect(); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		broker.waitRetained(t, "test/availability", PayloadOnline)
+
+		client.Disconnect()
+		broker.waitRetained(t, "test/availability", PayloadOffline)
+	})
+}
+
+func TestClientRepublishesOnHomeAssistantBirth(t *testing.T) {
+	forEachVersion(t, func(t *testing.T, version int) {
+		addr := freeAddr(t)
+		broker := startBroker(t, addr)
+
+		var states atomic.Int32
+		err := broker.Subscribe("test/state", 1, func(_ *mqttserver.Client, _ packets.Subscription, pk packets.Packet) {
+			if string(pk.Payload) == "42" {
+				states.Add(1)
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		client := newTestClient(t, Config{
+			BrokerURL:         "tcp://" + addr,
+			ProtocolVersion:   version,
+			AvailabilityTopic: "test/availability",
+			BirthTopic:        "test/ha/status",
+		})
+
+		// Queue discovery and state before connecting so they are published exactly once on connect
+		discoveryTopic := "homeassistant/sensor/node/object/config"
+		if err := client.PublishDiscovery("sensor", "node", "object", map[string]string{"name": "Test"}); err != nil {
+			t.Fatalf("failed to queue discovery: %v", err)
+		}
+		_ = client.PublishState("test/state", "42")
+
+		// Rediscovery can refresh a config before it is republished
+		client.OnRediscover(func() {
+			_ = client.PublishDiscovery("sensor", "node", "object", map[string]string{"name": "Updated"})
+		})
+
+		if err := client.Connect(); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer client.Disconnect()
+
+		broker.waitRetained(t, discoveryTopic, `{"name":"Test"}`)
+		eventually(t, func() bool { return states.Load() == 1 }, "state was not published on connect")
+
+		// Simulate Home Assistant losing its entities and restarting
+		for _, topic := range []string{discoveryTopic, "test/availability"} {
+			if err := broker.Publish(topic, nil, true, 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := broker.Publish("test/ha/status", []byte(PayloadOffline), false, 1); err != nil {
+			t.Fatal(err)
+		}
+		if err := broker.Publish("test/ha/status", []byte(PayloadOnline), false, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		broker.waitRetained(t, discoveryTopic, `{"name":"Updated"}`)
+		broker.waitRetained(t, "test/availability", PayloadOnline)
+		eventually(t, func() bool { return states.Load() == 2 }, "state was not republished")
+	})
+}
+
+func TestV5RequestResponse(t *testing.T) {
+	addr := freeAddr(t)
+	startBroker(t, addr)
+
+	client := newTestClient(t, Config{BrokerURL: "tcp://" + addr, ProtocolVersion: 5})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Disconnect()
+
+	err := client.Subscribe("test/command/+", 1, func(msg Message) error {
+		if msg.Topic == "test/command/fail" {
+			return errors.New("command failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	responses := make(chan *paho.Publish, 2)
+	requester := connectRequester(t, addr, func(pb *paho.Publish) { responses <- pb })
+
+	tests := []struct {
+		topic       string
+		correlation string
+		want        Response
+	}{
+		{topic: "test/command/ok", correlation: "request-1", want: Response{Success: true}},
+		{topic: "test/command/fail", correlation: "request-2", want: Response{Success: false, Error: "command failed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			eventually(t, client.IsConnected, "client did not connect")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_, err := requester.Publish(ctx, &paho.Publish{
+				Topic:   tt.topic,
+				QoS:     1,
+				Payload: []byte("PRESS"),
+				Properties: &paho.PublishProperties{
+					ResponseTopic:   "test/response",
+					CorrelationData: []byte(tt.correlation),
+				},
+			})
+			if err != nil {
+				t.Fatalf("failed to publish request: %v", err)
+			}
+
+			select {
+			case pb := <-responses:
+				if got := string(pb.Properties.CorrelationData); got != tt.correlation {
+					t.Errorf("correlation data = %q, want %q", got, tt.correlation)
+				}
+				var got Response
+				if err := json.Unmarshal(pb.Payload, &got); err != nil {
+					t.Fatalf("invalid response %q: %v", pb.Payload, err)
+				}
+				if got != tt.want {
+					t.Errorf("response = %+v, want %+v", got, tt.want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no response received")
+			}
+		})
+	}
+}
+
+// connectRequester connects a plain MQTT v5 client that listens on test/response
+func connectRequester(t *testing.T, addr string, onResponse func(*paho.Publish)) *autopaho.ConnectionManager {
+	t.Helper()
+
+	serverURL, _ := url.Parse("mqtt://" + addr)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	cm, err := autopaho.NewConnection(ctx, autopaho.ClientConfig{
+		ServerUrls: []*url.URL{serverURL},
+		KeepAlive:  30,
+		ClientConfig: paho.ClientConfig{
+			ClientID: "requester",
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(received paho.PublishReceived) (bool, error) {
+					onResponse(received.Packet)
+					return true, nil
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	awaitCtx, awaitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer awaitCancel()
+	if err := cm.AwaitConnection(awaitCtx); err != nil {
+		t.Fatalf("requester failed to connect: %v", err)
+	}
+	if _, err := cm.Subscribe(awaitCtx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: "test/response", QoS: 1}},
+	}); err != nil {
+		t.Fatalf("requester failed to subscribe: %v", err)
+	}
+	return cm
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b/c", "a/b/c", true},
+		{"a/b/c", "a/b", false},
+		{"a/+/c", "a/b/c", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "a/b", true},
+		{"a/b", "a/b/c", false},
+	}
+	for _, tt := range tests {
+		if got := matchTopic(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("matchTopic(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
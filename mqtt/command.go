@@ -0,0 +1,91 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// SubscribeCommand subscribes to a topic that triggers an action. Retained
+// messages are cleared from the broker and ignored, so an accidental retained
+// message does not run the action on every start. The empty message that
+// clears it, and messages with a timestamp older than CommandMaxAge, are
+// ignored too. Other empty messages are passed on, e.g. to clear a text entity.
+func (s *session) SubscribeCommand(topic string, callback MessageHandler) error {
+	return s.Subscribe(topic, 1, func(msg Message) error {
+		if msg.Retained {
+			log.Warn("Ignoring retained message on command topic and clearing it", "topic", msg.Topic)
+			if len(msg.Payload) > 0 {
+				s.clearRetained(msg.Topic)
+			}
+			return nil
+		}
+		if len(msg.Payload) == 0 && s.cleared(msg.Topic) {
+			return nil
+		}
+
+		if s.commandMaxAge > 0 {
+			if sent, ok := payloadTimestamp(msg.Payload); ok {
+				if age := time.Since(sent); age > s.commandMaxAge {
+					log.Warn("Ignoring command message that is too old", "age", age.Round(time.Second), "topic", msg.Topic)
+					return fmt.Errorf("message is %v old, older than the maximum of %v", age.Round(time.Second), s.commandMaxAge)
+				}
+			}
+		}
+
+		return callback(msg)
+	})
+}
+
+// clearRetained clears the retained message on a command topic. The broker
+// sends the empty message that clears it to subscribers too, so it is
+// remembered to be ignored.
+func (s *session) clearRetained(topic string) {
+	s.mu.Lock()
+	s.clearing[topic] = true
+	s.mu.Unlock()
+
+	if err := s.transport.Publish(topic, 1, true, ""); err != nil {
+		log.Error("Failed to clear retained message", "error", err, "topic", topic)
+		s.cleared(topic)
+	}
+}
+
+// cleared reports whether an empty message on a topic is the one sent to
+// clear a retained message, which is then no longer expected
+func (s *session) cleared(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clearing := s.clearing[topic]
+	delete(s.clearing, topic)
+	return clearing
+}
+
+// payloadTimestamp returns the timestamp of a JSON object payload, given as
+// an RFC 3339 string or as seconds or milliseconds since the Unix epoch
+func payloadTimestamp(payload []byte) (time.Time, bool) {
+	var body struct {
+		Timestamp any `json:"timestamp"`
+	}
+	if json.Unmarshal(payload, &body) != nil {
+		return time.Time{}, false
+	}
+
+	switch timestamp := body.Timestamp.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339, timestamp)
+		return t, err == nil
+	case float64:
+		// Anything past the year 33658 in seconds is treated as milliseconds
+		if timestamp > 1e12 {
+			return time.UnixMilli(int64(timestamp)), true
+		}
+		seconds, fraction := math.Modf(timestamp)
+		return time.Unix(int64(seconds), int64(fraction*1e9)), true
+	}
+	return time.Time{}, false
+}
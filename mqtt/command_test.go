@@ -0,0 +1,139 @@
+package mqtt
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribeCommandIgnoresRetainedMessages(t *testing.T) {
+	forEachVersion(t, func(t *testing.T, version int) {
+		addr := freeAddr(t)
+		broker := startBroker(t, addr)
+
+		// A command left retained on the broker, e.g. by a misconfigured automation
+		if err := broker.Publish("test/command", []byte("PRESS"), true, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		client := newTestClient(t, Config{BrokerURL: "tcp://" + addr, ProtocolVersion: version})
+		var mu sync.Mutex
+		var received []string
+		err := client.SubscribeCommand("test/command", func(msg Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, string(msg.Payload))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+		if err := client.Connect(); err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+		defer client.Disconnect()
+
+		// The retained message is cleared rather than run
+		broker.waitRetained(t, "test/command", "")
+
+		if err := broker.Publish("test/command", []byte("LIVE"), false, 1); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received) > 0
+		}, "live command was not received")
+
+		// An empty message other than the one clearing the retained message is passed on
+		if err := broker.Publish("test/command", nil, false, 1); err != nil {
+			t.Fatal(err)
+		}
+		eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(received) > 1
+		}, "empty command was not received")
+
+		mu.Lock()
+		defer mu.Unlock()
+		if len(received) != 2 || received[0] != "LIVE" || received[1] != "" {
+			t.Errorf("received = %q, want only the live and empty commands", received)
+		}
+	})
+}
+
+func TestSubscribeCommandDropsOldMessages(t *testing.T) {
+	addr := freeAddr(t)
+	broker := startBroker(t, addr)
+
+	client := newTestClient(t, Config{BrokerURL: "tcp://" + addr, CommandMaxAge: time.Minute})
+	received := make(chan string, 10)
+	err := client.SubscribeCommand("test/command", func(msg Message) error {
+		received <- string(msg.Payload)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer client.Disconnect()
+	eventually(t, func() bool { return len(broker.Topics.Subscribers("test/command").Subscriptions) > 0 }, "client did not subscribe")
+
+	old := time.Now().Add(-time.Hour)
+	payloads := []string{
+		fmt.Sprintf(`{"timestamp":%q}`, old.Format(time.RFC3339)),
+		fmt.Sprintf(`{"timestamp":%d}`, old.Unix()),
+		fmt.Sprintf(`{"timestamp":%d}`, old.UnixMilli()),
+		fmt.Sprintf(`{"timestamp":%q}`, time.Now().Format(time.RFC3339)),
+		"PRESS",
+	}
+	for _, payload := range payloads {
+		if err := broker.Publish("test/command", []byte(payload), false, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := payloads[3:]
+	for _, payload := range want {
+		select {
+		case got := <-received:
+			if got != payload {
+				t.Errorf("received %q, want %q", got, payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not receive %q", payload)
+		}
+	}
+	select {
+	case got := <-received:
+		t.Errorf("unexpected command %q", got)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestPayloadTimestamp(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		payload string
+		ok      bool
+	}{
+		{`{"timestamp":"2024-05-01T12:00:00Z"}`, true},
+		{fmt.Sprintf(`{"timestamp":%d}`, want.Unix()), true},
+		{fmt.Sprintf(`{"timestamp":%d}`, want.UnixMilli()), true},
+		{`{"timestamp":"yesterday"}`, false},
+		{`{"action":"press"}`, false},
+		{`PRESS`, false},
+	}
+	for _, tt := range tests {
+		got, ok := payloadTimestamp([]byte(tt.payload))
+		if ok != tt.ok {
+			t.Errorf("payloadTimestamp(%s) ok = %v, want %v", tt.payload, ok, tt.ok)
+		} else if ok && !got.Equal(want) {
+			t.Errorf("payloadTimestamp(%s) = %v, want %v", tt.payload, got, want)
+		}
+	}
+}
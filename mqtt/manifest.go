@@ -0,0 +1,133 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// DefaultManifestPath is the manifest file used when MANIFEST_FILE is not set
+const DefaultManifestPath = "manifest.json"
+
+// Manifest records the discovery topics published by the last run, so
+// entities that are no longer produced can be removed from Home Assistant
+type Manifest struct {
+	path   string
+	Topics []string `json:"topics"`
+}
+
+// LoadManifest reads the manifest at path. A missing file results in an empty manifest.
+func LoadManifest(path string) (*Manifest, error) {
+	manifest := &Manifest{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %v", err)
+	}
+	return manifest, nil
+}
+
+// Save writes the manifest back to its file
+func (m *Manifest) Save() error {
+	sort.Strings(m.Topics)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+
+	if dir := filepath.Dir(m.path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create manifest directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(m.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return nil
+}
+
+// Record saves the discovery topics published now, if they changed since the
+// manifest was last saved, so entities published after startup are recorded too
+func (m *Manifest) Record(topics []string) error {
+	topics = slices.Sorted(slices.Values(topics))
+	if slices.Equal(m.Topics, topics) {
+		return nil
+	}
+	m.Topics = topics
+	return m.Save()
+}
+
+// CleanupStale clears the retained discovery configs listed in the manifest
+// that the client no longer publishes, then records the current ones
+func CleanupStale(client Client, m *Manifest) error {
+	current := client.DiscoveryTopics()
+	published := make(map[string]bool, len(current))
+	for _, topic := range current {
+		published[topic] = true
+	}
+
+	for _, topic := range m.Topics {
+		if published[topic] {
+			continue
+		}
+		log.Info("Removing stale entity", "topic", topic)
+		if err := client.ClearDiscovery(topic); err != nil {
+			return fmt.Errorf("failed to remove stale entity %s: %v", topic, err)
+		}
+	}
+
+	m.Topics = current
+	return m.Save()
+}
+
+// Purge removes every entity of a node from Home Assistant. It clears the
+// retained discovery configs in the manifest as well as any still retained
+// on the broker under the node ID, then empties the manifest.
+func Purge(client Client, nodeID string, m *Manifest, wait time.Duration) error {
+	var mu sync.Mutex
+	topics := map[string]bool{}
+	for _, topic := range m.Topics {
+		topics[topic] = true
+	}
+
+	// The broker sends every retained config matching the filter on subscribe
+	filter := fmt.Sprintf("%s/+/%s/+/config", discoveryPrefix, nodeID)
+	err := client.Subscribe(filter, 1, func(msg Message) error {
+		if msg.Retained && len(msg.Payload) > 0 {
+			mu.Lock()
+			topics[msg.Topic] = true
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find retained entities: %v", err)
+	}
+	time.Sleep(wait)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, topic := range sortedKeys(topics) {
+		log.Info("Removing entity", "topic", topic)
+		if err := client.ClearDiscovery(topic); err != nil {
+			return fmt.Errorf("failed to remove entity %s: %v", topic, err)
+		}
+	}
+
+	m.Topics = nil
+	return m.Save()
+}
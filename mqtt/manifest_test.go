@@ -0,0 +1,140 @@
+package mqtt
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func connectTestClient(t *testing.T, addr string) Client {
+	t.Helper()
+
+	client := newTestClient(t, Config{BrokerURL: "tcp://" + addr})
+	if err := client.Connect(); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(client.Disconnect)
+	eventually(t, client.IsConnected, "client did not connect")
+	return client
+}
+
+func TestLoadMissingManifest(t *testing.T) {
+	manifest, err := LoadManifest(filepath.Join(t.TempDir(), "manifest.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(manifest.Topics) != 0 {
+		t.Errorf("expected an empty manifest, got %v", manifest.Topics)
+	}
+}
+
+func TestManifestRecordsLaterTopics(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	manifest := &Manifest{path: path, Topics: []string{"homeassistant/button/node/a/config"}}
+
+	// A topic published after startup, e.g. a hotplugged battery
+	topics := []string{"homeassistant/sensor/node/battery/config", "homeassistant/button/node/a/config"}
+	if err := manifest.Record(topics); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	saved, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"homeassistant/button/node/a/config", "homeassistant/sensor/node/battery/config"}
+	if !reflect.DeepEqual(saved.Topics, want) {
+		t.Errorf("saved manifest = %v, want %v", saved.Topics, want)
+	}
+}
+
+func TestCleanupStaleRemovesEntitiesNoLongerPublished(t *testing.T) {
+	addr := freeAddr(t)
+	broker := startBroker(t, addr)
+
+	const (
+		kept    = "homeassistant/button/node/power_restart/config"
+		removed = "homeassistant/button/node/power_restart_to_windows/config"
+	)
+	for _, topic := range []string{kept, removed} {
+		if err := broker.Publish(topic, []byte(`{"name":"old"}`), true, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "manifest.json")
+	previous := &Manifest{path: path, Topics: []string{kept, removed}}
+	if err := previous.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := connectTestClient(t, addr)
+	if err := client.PublishDiscovery("button", "node", "power_restart", map[string]string{"name": "Restart"}); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CleanupStale(client, manifest); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+
+	broker.waitRetained(t, kept, `{"name":"Restart"}`)
+	eventually(t, func() bool {
+		_, ok := broker.retained(removed)
+		return !ok
+	}, "stale entity was not removed")
+	if got := client.DiscoveryTopics(); !reflect.DeepEqual(got, []string{kept}) {
+		t.Errorf("discovery topics = %v, want %v", got, []string{kept})
+	}
+
+	saved, err := LoadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(saved.Topics, []string{kept}) {
+		t.Errorf("saved manifest = %v, want %v", saved.Topics, []string{kept})
+	}
+}
+
+func TestPurgeRemovesAllEntitiesOfNode(t *testing.T) {
+	addr := freeAddr(t)
+	broker := startBroker(t, addr)
+
+	const (
+		onBroker   = "homeassistant/sensor/node/status/config"
+		inManifest = "homeassistant/button/node/power_shutdown/config"
+		otherNode  = "homeassistant/button/other/power_shutdown/config"
+	)
+	for _, topic := range []string{onBroker, otherNode} {
+		if err := broker.Publish(topic, []byte(`{"name":"Entity"}`), true, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := &Manifest{path: filepath.Join(t.TempDir(), "manifest.json"), Topics: []string{inManifest}}
+	client := connectTestClient(t, addr)
+
+	if err := Purge(client, "node", manifest, 200*time.Millisecond); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+
+	eventually(t, func() bool {
+		_, ok := broker.retained(onBroker)
+		return !ok
+	}, "retained entity on the broker was not removed")
+	if _, ok := broker.retained(otherNode); !ok {
+		t.Error("entity of another node was removed")
+	}
+
+	saved, err := LoadManifest(manifest.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Topics) != 0 {
+		t.Errorf("manifest was not emptied: %v", saved.Topics)
+	}
+}
@@ -0,0 +1,265 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+)
+
+// transport is the protocol specific part of a client used by the session
+type transport interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) error
+	IsConnected() bool
+	subscribe(topic string, qos byte) error
+}
+
+// subscription is a topic subscription to restore on reconnect
+type subscription struct {
+	qos      byte
+	callback MessageHandler
+}
+
+// session remembers subscriptions, discovery payloads and states so they can
+// be replayed after a reconnect or when Home Assistant restarts. It is shared
+// by every protocol version.
+type session struct {
+	transport         transport
+	availabilityTopic string
+	commandMaxAge     time.Duration
+
+	mu            sync.Mutex
+	subscriptions map[string]subscription
+	discovery     map[string]interface{}
+	states        map[string]interface{}
+	rediscover    []func()
+	// clearing holds the command topics whose retained message is being
+	// cleared, until the empty message that clears it comes back
+	clearing map[string]bool
+}
+
+func newSession(t transport, cfg Config) *session {
+	s := &session{
+		transport:         t,
+		availabilityTopic: cfg.AvailabilityTopic,
+		commandMaxAge:     cfg.CommandMaxAge,
+		subscriptions:     map[string]subscription{},
+		discovery:         map[string]interface{}{},
+		states:            map[string]interface{}{},
+		clearing:          map[string]bool{},
+	}
+	s.subscriptions[cfg.BirthTopic] = subscription{qos: 1, callback: s.onBirth}
+	return s
+}
+
+// PublishDiscovery publishes a Home Assistant discovery message.
+// The config is remembered and republished after every reconnect.
+func (s *session) PublishDiscovery(component, nodeID, objectID string, config interface{}) error {
+	topic := DiscoveryTopic(component, nodeID, objectID)
+
+	s.mu.Lock()
+	s.discovery[topic] = config
+	s.mu.Unlock()
+
+	if !s.transport.IsConnected() {
+		log.Debug("Queued discovery message until connected", "topic", topic)
+		return nil
+	}
+
+	err := s.transport.Publish(topic, 1, true, config)
+	if err == nil {
+		log.Info("Published discovery message", "topic", topic)
+	}
+	return err
+}
+
+// DiscoveryTopic returns the topic of a Home Assistant discovery config
+func DiscoveryTopic(component, nodeID, objectID string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/config", discoveryPrefix, component, nodeID, objectID)
+}
+
+// DiscoveryTopics returns the topic of every discovery config published so far
+func (s *session) DiscoveryTopics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return sortedKeys(s.discovery)
+}
+
+// ClearDiscovery removes the retained discovery config on a topic, which
+// deletes the entity from Home Assistant, and stops republishing it
+func (s *session) ClearDiscovery(topic string) error {
+	s.mu.Lock()
+	delete(s.discovery, topic)
+	s.mu.Unlock()
+
+	return s.transport.Publish(topic, 1, true, "")
+}
+
+// PublishState publishes a state payload to a topic.
+// The latest state is remembered and republished after a reconnect or
+// when Home Assistant restarts.
+func (s *session) PublishState(topic string, payload interface{}) error {
+	s.mu.Lock()
+	s.states[topic] = payload
+	s.mu.Unlock()
+
+	return s.transport.Publish(topic, 1, false, payload)
+}
+
+// Subscribe subscribes to a topic with specified QoS and message handler.
+// The subscription is remembered and restored after every reconnect.
+func (s *session) Subscribe(topic string, qos byte, callback MessageHandler) error {
+	s.mu.Lock()
+	s.subscriptions[topic] = subscription{qos: qos, callback: callback}
+	s.mu.Unlock()
+
+	if !s.transport.IsConnected() {
+		log.Debug("Queued subscription until connected", "topic", topic)
+		return nil
+	}
+
+	return s.transport.subscribe(topic, qos)
+}
+
+// OnRediscover registers a callback that runs when Home Assistant restarts,
+// before the remembered discovery configs are republished
+func (s *session) OnRediscover(callback func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rediscover = append(s.rediscover, callback)
+}
+
+// handler returns the callback of the subscription to a filter
+func (s *session) handler(filter string) (MessageHandler, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[filter]
+	return sub.callback, ok
+}
+
+// handlers returns the callbacks of every subscription matching a topic
+func (s *session) handlers(topic string) []MessageHandler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var handlers []MessageHandler
+	for filter, sub := range s.subscriptions {
+		if matchTopic(filter, topic) {
+			handlers = append(handlers, sub.callback)
+		}
+	}
+	return handlers
+}
+
+// onConnected replays the session after every (re)connect
+func (s *session) onConnected() {
+	// Replace the Last Will left by a previous connection
+	s.publishAvailability(PayloadOnline)
+
+	s.restoreSubscriptions()
+	s.republishDiscovery()
+	s.republishStates()
+}
+
+// onBirth republishes everything Home Assistant needs when it comes back online
+func (s *session) onBirth(msg Message) error {
+	if string(msg.Payload) != PayloadOnline {
+		return nil
+	}
+
+	log.Info("Home Assistant is online, republishing discovery", "topic", msg.Topic)
+
+	s.mu.Lock()
+	callbacks := append([]func(){}, s.rediscover...)
+	s.mu.Unlock()
+	for _, callback := range callbacks {
+		callback()
+	}
+
+	s.republishDiscovery()
+	s.publishAvailability(PayloadOnline)
+	s.republishStates()
+	return nil
+}
+
+// restoreSubscriptions subscribes again to every remembered topic
+func (s *session) restoreSubscriptions() {
+	s.mu.Lock()
+	subscriptions := make(map[string]subscription, len(s.subscriptions))
+	for topic, sub := range s.subscriptions {
+		subscriptions[topic] = sub
+	}
+	s.mu.Unlock()
+
+	for _, topic := range sortedKeys(subscriptions) {
+		if err := s.transport.subscribe(topic, subscriptions[topic].qos); err != nil {
+			log.Error("Failed to restore subscription", "error", err, "topic", topic)
+		}
+	}
+}
+
+// republishDiscovery publishes every remembered discovery config again
+func (s *session) republishDiscovery() {
+	s.mu.Lock()
+	discovery := make(map[string]interface{}, len(s.discovery))
+	for topic, config := range s.discovery {
+		discovery[topic] = config
+	}
+	s.mu.Unlock()
+
+	for _, topic := range sortedKeys(discovery) {
+		if err := s.transport.Publish(topic, 1, true, discovery[topic]); err != nil {
+			log.Error("Failed to republish discovery message", "error", err, "topic", topic)
+		}
+	}
+}
+
+// republishStates publishes the latest remembered state on every state topic
+func (s *session) republishStates() {
+	s.mu.Lock()
+	states := make(map[string]interface{}, len(s.states))
+	for topic, state := range s.states {
+		states[topic] = state
+	}
+	s.mu.Unlock()
+
+	for _, topic := range sortedKeys(states) {
+		if err := s.transport.Publish(topic, 1, false, states[topic]); err != nil {
+			log.Error("Failed to republish state", "error", err, "topic", topic)
+		}
+	}
+}
+
+// publishAvailability publishes a retained payload to the availability topic
+func (s *session) publishAvailability(payload string) {
+	if s.availabilityTopic == "" {
+		return
+	}
+	if err := s.transport.Publish(s.availabilityTopic, 1, true, payload); err != nil {
+		log.Error("Failed to publish availability", "error", err, "payload", payload)
+	}
+}
+
+// matchTopic reports whether a topic matches a subscription filter with + and # wildcards
+func matchTopic(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
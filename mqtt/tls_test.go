@@ -0,0 +1,229 @@
+package mqtt
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// testPKI is a self-signed CA with a broker and a client certificate
+type testPKI struct {
+	dir        string
+	ca         *x509.Certificate
+	caKey      *ecdsa.PrivateKey
+	caPool     *x509.CertPool
+	serverCert tls.Certificate
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "go-commands test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pki := &testPKI{dir: t.TempDir(), ca: ca, caKey: key, caPool: x509.NewCertPool()}
+	pki.caPool.AddCert(ca)
+	pki.writePEM(t, "ca.pem", "CERTIFICATE", der)
+
+	// The broker certificate is only valid for broker.test, not the address we dial
+	certPEM, keyPEM := pki.issue(t, 2, "broker.test", x509.ExtKeyUsageServerAuth)
+	pki.serverCert, err = tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientCert, clientKey := pki.issue(t, 3, "go-commands", x509.ExtKeyUsageClientAuth)
+	pki.write(t, "client.pem", clientCert)
+	pki.write(t, "client-key.pem", clientKey)
+
+	return pki
+}
+
+// issue signs a certificate for name and returns the certificate and key as PEM
+func (p *testPKI) issue(t *testing.T, serial int64, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.ca, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (p *testPKI) writePEM(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+	p.write(t, name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}))
+}
+
+func (p *testPKI) write(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(p.dir, name), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (p *testPKI) path(name string) string {
+	return filepath.Join(p.dir, name)
+}
+
+// startTLSBroker starts a broker that requires TLS, and client certificates if mutual is set
+func (p *testPKI) startTLSBroker(t *testing.T, mutual bool) string {
+	t.Helper()
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{p.serverCert},
+	}
+	if mutual {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = p.caPool
+	}
+
+	addr := freeAddr(t)
+	startBrokerWithListener(t, addr, listeners.Config{ID: "tls", Address: addr, TLSConfig: tlsConfig})
+	return "ssl://" + addr
+}
+
+func TestClientTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	tlsBroker := pki.startTLSBroker(t, false)
+	mutualBroker := pki.startTLSBroker(t, true)
+
+	tests := []struct {
+		name    string
+		broker  string
+		tls     TLSConfig
+		wantErr bool
+	}{
+		{
+			name:   "trusted CA with server name override",
+			broker: tlsBroker,
+			tls:    TLSConfig{CAFile: pki.path("ca.pem"), ServerName: "broker.test"},
+		},
+		{
+			name:    "trusted CA with wrong server name",
+			broker:  tlsBroker,
+			tls:     TLSConfig{CAFile: pki.path("ca.pem")},
+			wantErr: true,
+		},
+		{
+			name:    "system roots do not trust the test CA",
+			broker:  tlsBroker,
+			tls:     TLSConfig{ServerName: "broker.test"},
+			wantErr: true,
+		},
+		{
+			name:   "insecure skip verify",
+			broker: tlsBroker,
+			tls:    TLSConfig{InsecureSkipVerify: true},
+		},
+		{
+			name:   "mutual TLS with client certificate",
+			broker: mutualBroker,
+			tls: TLSConfig{
+				CAFile:     pki.path("ca.pem"),
+				CertFile:   pki.path("client.pem"),
+				KeyFile:    pki.path("client-key.pem"),
+				ServerName: "broker.test",
+			},
+		},
+		{
+			name:    "mutual TLS without client certificate",
+			broker:  mutualBroker,
+			tls:     TLSConfig{CAFile: pki.path("ca.pem"), ServerName: "broker.test"},
+			wantErr: true,
+		},
+		{
+			name:    "client certificate without key",
+			broker:  mutualBroker,
+			tls:     TLSConfig{CAFile: pki.path("ca.pem"), CertFile: pki.path("client.pem")},
+			wantErr: true,
+		},
+		{
+			name:    "missing CA file",
+			broker:  tlsBroker,
+			tls:     TLSConfig{CAFile: pki.path("missing.pem")},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		forEachVersion(t, func(t *testing.T, version int) {
+			t.Run(tt.name, func(t *testing.T) {
+				client := newTestClient(t, Config{BrokerURL: tt.broker, ProtocolVersion: version, TLS: tt.tls})
+				err := client.Connect()
+				defer client.Disconnect()
+
+				if tt.wantErr && err == nil {
+					t.Fatal("expected the connection to fail")
+				}
+				if !tt.wantErr && err != nil {
+					t.Fatalf("failed to connect: %v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestIsTLSBroker(t *testing.T) {
+	for url, want := range map[string]bool{
+		"tcp://localhost:1883":     false,
+		"ws://localhost:9001/mqtt": false,
+		"ssl://localhost:8883":     true,
+		"mqtts://localhost:8883":   true,
+		"wss://localhost:8884/":    true,
+	} {
+		if got := isTLSBroker(url); got != want {
+			t.Errorf("isTLSBroker(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package mqtt
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// v3Client is an MQTT 3.1.1 client
+type v3Client struct {
+	*session
+	client    MQTT.Client
+	brokerURL string
+	username  string
+	password  string
+	clientID  string
+	persist   bool
+	tls       TLSConfig
+	connected atomic.Bool
+	// stopRetry is closed by Disconnect to stop retrying the first connection
+	stopRetry chan struct{}
+}
+
+func newV3Client(cfg Config, clientID string) *v3Client {
+	c := &v3Client{
+		brokerURL: cfg.BrokerURL,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		clientID:  clientID,
+		persist:   cfg.PersistentSession,
+		tls:       cfg.TLS,
+	}
+	c.session = newSession(c, cfg)
+	return c
+}
+
+// Connect establishes connection to the MQTT broker
+func (c *v3Client) Connect() error {
+	opts := MQTT.NewClientOptions()
+	opts.AddBroker(c.brokerURL)
+	opts.SetClientID(c.clientID)
+	opts.SetUsername(c.username)
+	opts.SetPassword(c.password)
+	opts.SetCleanSession(!c.persist)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(30 * time.Second)
+	// Handlers may publish, which would deadlock while ordered delivery blocks the router
+	opts.SetOrderMatters(false)
+	opts.SetOnConnectHandler(c.onConnect)
+	opts.SetConnectionLostHandler(c.onConnectionLost)
+	if c.availabilityTopic != "" {
+		opts.SetWill(c.availabilityTopic, PayloadOffline, 1, true)
+	}
+	if isTLSBroker(c.brokerURL) || c.tls.enabled() {
+		tlsConfig, err := c.tls.build()
+		if err != nil {
+			return fmt.Errorf("invalid TLS configuration: %v", err)
+		}
+		if tlsConfig.InsecureSkipVerify {
+			log.Warn("TLS certificate verification is disabled, the broker connection is not secure", "broker", c.brokerURL)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	c.client = MQTT.NewClient(opts)
+	c.stopRetry = make(chan struct{})
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		// Auto reconnect only applies once connected, so retry until then
+		go c.retryConnect(c.stopRetry)
+		return fmt.Errorf("failed to connect to MQTT broker, %w: %v", ErrRetrying, token.Error())
+	}
+
+	return nil
+}
+
+// retryConnect tries to connect with an increasing delay until it succeeds
+// or stop is closed
+func (c *v3Client) retryConnect(stop <-chan struct{}) {
+	delay := time.Second
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		token := c.client.Connect()
+		if token.Wait() && token.Error() == nil {
+			return
+		}
+		log.Debug("Failed to connect to MQTT broker, retrying", "error", token.Error(), "delay", delay)
+		delay = min(delay*2, 30*time.Second)
+	}
+}
+
+// Disconnect publishes offline availability and cleanly disconnects from the MQTT broker.
+// The Last Will is not sent on a clean disconnect, so offline is published here.
+func (c *v3Client) Disconnect() {
+	if c.stopRetry != nil {
+		select {
+		case <-c.stopRetry:
+		default:
+			close(c.stopRetry)
+		}
+	}
+	if c.client != nil && c.client.IsConnected() {
+		c.publishAvailability(PayloadOffline)
+		c.client.Disconnect(250)
+	}
+}
+
+// Publish sends a message to a specific topic with QoS
+func (c *v3Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	if c.client == nil || !c.client.IsConnected() {
+		return fmt.Errorf("client is not connected")
+	}
+
+	payloadBytes, err := encodePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	token := c.client.Publish(topic, qos, retained, payloadBytes)
+	if token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to publish message: %v", token.Error())
+	}
+
+	log.Info("Published message", "topic", topic, "payload", payload)
+
+	return nil
+}
+
+func (c *v3Client) subscribe(topic string, qos byte) error {
+	callback := func(client MQTT.Client, msg MQTT.Message) {
+		c.onMessage(topic, msg)
+	}
+	if token := c.client.Subscribe(topic, qos, callback); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("failed to subscribe to topic: %v", token.Error())
+	}
+	log.Info("Subscribed to topic", "topic", topic)
+	return nil
+}
+
+// onMessage passes a received message to the handler of the subscription it matched.
+// MQTT 3.1.1 has no response topic, so errors are left to the handler to report.
+func (c *v3Client) onMessage(filter string, msg MQTT.Message) {
+	handler, ok := c.handler(filter)
+	if !ok {
+		return
+	}
+	_ = handler(Message{
+		Topic:    msg.Topic(),
+		Payload:  msg.Payload(),
+		Retained: msg.Retained(),
+	})
+}
+
+func (c *v3Client) onConnect(client MQTT.Client) {
+	c.connected.Store(true)
+	log.Info("Connected to MQTT broker", "broker", c.brokerURL, "protocol", "3.1.1")
+
+	c.onConnected()
+}
+
+func (c *v3Client) onConnectionLost(client MQTT.Client, err error) {
+	c.connected.Store(false)
+	log.Error("Lost connection to MQTT broker", "error", err)
+}
+
+// IsConnected returns the current connection status
+func (c *v3Client) IsConnected() bool {
+	return c.connected.Load() && c.client != nil && c.client.IsConnected()
+}
@@ -0,0 +1,244 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+)
+
+const (
+	// v5Timeout limits how long a single publish or subscribe may take
+	v5Timeout = 10 * time.Second
+	// v5SessionExpiry is how long the broker keeps a persistent session, in seconds
+	v5SessionExpiry = 7 * 24 * 60 * 60
+)
+
+// v5Client is an MQTT 5 client. Messages with a response topic are treated
+// as requests and answered with a Response carrying their correlation data.
+type v5Client struct {
+	*session
+	cm        atomic.Pointer[autopaho.ConnectionManager]
+	cancel    context.CancelFunc
+	brokerURL string
+	username  string
+	password  string
+	clientID  string
+	persist   bool
+	tls       TLSConfig
+	connected atomic.Bool
+}
+
+func newV5Client(cfg Config, clientID string) *v5Client {
+	c := &v5Client{
+		brokerURL: cfg.BrokerURL,
+		username:  cfg.Username,
+		password:  cfg.Password,
+		clientID:  clientID,
+		persist:   cfg.PersistentSession,
+		tls:       cfg.TLS,
+	}
+	c.session = newSession(c, cfg)
+	return c
+}
+
+// Connect establishes connection to the MQTT broker
+func (c *v5Client) Connect() error {
+	serverURL, err := url.Parse(c.brokerURL)
+	if err != nil {
+		return fmt.Errorf("invalid broker URL: %v", err)
+	}
+
+	connectErrors := make(chan error, 1)
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{serverURL},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: !c.persist,
+		ReconnectBackoff:              autopaho.NewExponentialBackoff(time.Second, 30*time.Second, 2*time.Second, 2),
+		ConnectUsername:               c.username,
+		ConnectPassword:               []byte(c.password),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			c.cm.Store(cm)
+			c.connected.Store(true)
+			log.Info("Connected to MQTT broker", "broker", c.brokerURL, "protocol", "5")
+			// OnConnectionUp must not block
+			go c.onConnected()
+		},
+		OnConnectionDown: func() bool {
+			c.connected.Store(false)
+			log.Error("Lost connection to MQTT broker", "broker", c.brokerURL)
+			return true
+		},
+		OnConnectError: func(err error) {
+			select {
+			case connectErrors <- err:
+			default:
+			}
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:          c.clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.onPublishReceived},
+		},
+	}
+	if c.persist {
+		cfg.SessionExpiryInterval = v5SessionExpiry
+	}
+	if c.availabilityTopic != "" {
+		cfg.WillMessage = &paho.WillMessage{
+			Topic:   c.availabilityTopic,
+			Payload: []byte(PayloadOffline),
+			QoS:     1,
+			Retain:  true,
+		}
+	}
+	if isTLSBroker(c.brokerURL) || c.tls.enabled() {
+		tlsConfig, err := c.tls.build()
+		if err != nil {
+			return fmt.Errorf("invalid TLS configuration: %v", err)
+		}
+		if tlsConfig.InsecureSkipVerify {
+			log.Warn("TLS certificate verification is disabled, the broker connection is not secure", "broker", c.brokerURL)
+		}
+		cfg.TlsCfg = tlsConfig
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cm, err := autopaho.NewConnection(ctx, cfg)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to connect to MQTT broker: %v", err)
+	}
+
+	// Report the first connection attempt like the v3 client. If it fails,
+	// autopaho keeps trying until Disconnect.
+	c.cancel = cancel
+	connected := make(chan error, 1)
+	go func() {
+		connected <- cm.AwaitConnection(ctx)
+	}()
+	select {
+	case err = <-connected:
+	case err = <-connectErrors:
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker, %w: %v", ErrRetrying, err)
+	}
+	return nil
+}
+
+// Disconnect publishes offline availability and cleanly disconnects from the MQTT broker.
+// The Last Will is not sent on a clean disconnect, so offline is published here.
+func (c *v5Client) Disconnect() {
+	if c.cancel == nil {
+		return
+	}
+	cm := c.cm.Load()
+	if cm == nil {
+		// Never connected, so only stop trying
+		c.cancel()
+		return
+	}
+	if c.IsConnected() {
+		c.publishAvailability(PayloadOffline)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v5Timeout)
+	defer cancel()
+	if err := cm.Disconnect(ctx); err != nil {
+		log.Debug("Failed to disconnect cleanly", "error", err)
+	}
+	c.cancel()
+	c.connected.Store(false)
+}
+
+// Publish sends a message to a specific topic with QoS
+func (c *v5Client) Publish(topic string, qos byte, retained bool, payload interface{}) error {
+	return c.publish(&paho.Publish{Topic: topic, QoS: qos, Retain: retained}, payload)
+}
+
+func (c *v5Client) publish(pb *paho.Publish, payload interface{}) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("client is not connected")
+	}
+
+	payloadBytes, err := encodePayload(payload)
+	if err != nil {
+		return err
+	}
+	pb.Payload = payloadBytes
+
+	ctx, cancel := context.WithTimeout(context.Background(), v5Timeout)
+	defer cancel()
+	if _, err := c.cm.Load().Publish(ctx, pb); err != nil {
+		return fmt.Errorf("failed to publish message: %v", err)
+	}
+
+	log.Info("Published message", "topic", pb.Topic, "payload", payload)
+
+	return nil
+}
+
+func (c *v5Client) subscribe(topic string, qos byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), v5Timeout)
+	defer cancel()
+
+	_, err := c.cm.Load().Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: qos}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to topic: %v", err)
+	}
+	log.Info("Subscribed to topic", "topic", topic)
+	return nil
+}
+
+// onPublishReceived passes a received message to the handlers subscribed to its topic.
+// Handlers run on their own goroutine as they may publish, which must not block paho.
+func (c *v5Client) onPublishReceived(received paho.PublishReceived) (bool, error) {
+	pb := received.Packet
+	msg := Message{
+		Topic:    pb.Topic,
+		Payload:  pb.Payload,
+		Retained: pb.Retain,
+	}
+	if pb.Properties != nil {
+		msg.ResponseTopic = pb.Properties.ResponseTopic
+		msg.CorrelationData = pb.Properties.CorrelationData
+	}
+
+	handlers := c.handlers(msg.Topic)
+	for _, handler := range handlers {
+		go c.handle(handler, msg)
+	}
+	return len(handlers) > 0, nil
+}
+
+// handle runs a handler and answers the request if the message has a response topic
+func (c *v5Client) handle(handler MessageHandler, msg Message) {
+	err := handler(msg)
+	if msg.ResponseTopic == "" {
+		return
+	}
+
+	response := &paho.Publish{
+		Topic: msg.ResponseTopic,
+		QoS:   1,
+		Properties: &paho.PublishProperties{
+			CorrelationData: msg.CorrelationData,
+			ContentType:     "application/json",
+		},
+	}
+	if err := c.publish(response, NewResponse(err)); err != nil {
+		log.Error("Failed to publish response", "error", err, "topic", msg.ResponseTopic)
+	}
+}
+
+// IsConnected returns the current connection status
+func (c *v5Client) IsConnected() bool {
+	return c.connected.Load() && c.cm.Load() != nil
+}
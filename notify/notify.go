@@ -0,0 +1,174 @@
+// Package notify shows desktop notifications through org.freedesktop.Notifications
+package notify
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	// BusName is the bus name of the notification server
+	BusName = "org.freedesktop.Notifications"
+	// ObjectPath is the object the notification server exports
+	ObjectPath = dbus.ObjectPath("/org/freedesktop/Notifications")
+	// Interface holds the notification methods and signals
+	Interface = "org.freedesktop.Notifications"
+)
+
+// Urgency levels, as defined by the notification spec
+const (
+	UrgencyLow      byte = 0
+	UrgencyNormal   byte = 1
+	UrgencyCritical byte = 2
+)
+
+// ExpireDefault leaves how long a notification is shown to the server
+const ExpireDefault time.Duration = -1
+
+// ReasonDismissed is the NotificationClosed reason when the user dismissed it
+const ReasonDismissed uint32 = 2
+
+// Action is a button on a notification
+type Action struct {
+	// Key is reported back when the action is clicked
+	Key string
+	// Label is shown on the button
+	Label string
+}
+
+// Notification is a desktop notification
+type Notification struct {
+	AppName string
+	// Icon is an icon name from the theme, or a file path or URI
+	Icon    string
+	Summary string
+	Body    string
+	Actions []Action
+	Urgency byte
+	// Expire is how long the notification is shown: ExpireDefault for the
+	// server default, or zero to show it until it is dismissed
+	Expire time.Duration
+}
+
+// Event is a notification's action being clicked, or the notification closing
+type Event struct {
+	// ID is the notification's ID, as returned by Notify
+	ID uint32
+	// Action is the key of the clicked action, or empty if it closed
+	Action string
+	// Reason is why the notification closed, e.g. ReasonDismissed
+	Reason uint32
+}
+
+// Client talks to the notification server on a session bus
+type Client struct {
+	conn *dbus.Conn
+}
+
+// Connect connects to the session bus
+func Connect() (*Client, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to session bus: %v", err)
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient creates a Client using an existing bus connection
+func NewClient(conn *dbus.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Close closes the bus connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Notify shows a notification and returns its ID
+func (c *Client) Notify(n Notification) (uint32, error) {
+	actions := make([]string, 0, 2*len(n.Actions))
+	for _, action := range n.Actions {
+		actions = append(actions, action.Key, action.Label)
+	}
+	hints := map[string]dbus.Variant{"urgency": dbus.MakeVariant(n.Urgency)}
+
+	expire := int32(-1)
+	if n.Expire >= 0 {
+		expire = int32(n.Expire.Milliseconds())
+	}
+
+	var id uint32
+	err := c.conn.Object(BusName, ObjectPath).Call(Interface+".Notify", 0,
+		n.AppName, uint32(0), n.Icon, n.Summary, n.Body, actions, hints, expire,
+	).Store(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to show notification: %v", err)
+	}
+	return id, nil
+}
+
+// Watch blocks until stop is closed, calling event whenever an action is
+// clicked or a notification closes
+func (c *Client) Watch(event func(Event), stop <-chan struct{}) error {
+	matches := [][]dbus.MatchOption{
+		{
+			dbus.WithMatchObjectPath(ObjectPath),
+			dbus.WithMatchInterface(Interface),
+			dbus.WithMatchMember("ActionInvoked"),
+		},
+		{
+			dbus.WithMatchObjectPath(ObjectPath),
+			dbus.WithMatchInterface(Interface),
+			dbus.WithMatchMember("NotificationClosed"),
+		},
+	}
+	for _, match := range matches {
+		if err := c.conn.AddMatchSignal(match...); err != nil {
+			return fmt.Errorf("failed to watch notifications: %v", err)
+		}
+		defer c.conn.RemoveMatchSignal(match...)
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	c.conn.Signal(signals)
+	defer c.conn.RemoveSignal(signals)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("session bus connection closed")
+			}
+			// The connection delivers every signal to every channel, so
+			// ignore those that another watcher asked for
+			if e, ok := parseSignal(signal); ok {
+				event(e)
+			}
+		}
+	}
+}
+
+// parseSignal returns the event a notification signal reports
+func parseSignal(signal *dbus.Signal) (Event, bool) {
+	if signal.Path != ObjectPath || len(signal.Body) != 2 {
+		return Event{}, false
+	}
+	id, ok := signal.Body[0].(uint32)
+	if !ok {
+		return Event{}, false
+	}
+
+	switch signal.Name {
+	case Interface + ".ActionInvoked":
+		action, ok := signal.Body[1].(string)
+		return Event{ID: id, Action: action}, ok
+	case Interface + ".NotificationClosed":
+		reason, ok := signal.Body[1].(uint32)
+		return Event{ID: id, Reason: reason}, ok
+	}
+	return Event{}, false
+}
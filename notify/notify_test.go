@@ -0,0 +1,98 @@
+package notify_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/notify"
+	"github.com/timmo001/go-commands/notify/notifytest"
+)
+
+func TestNotify(t *testing.T) {
+	address := dbustest.NewBus(t)
+	server := notifytest.NewServer(t, address)
+	client := notify.NewClient(dbustest.Connect(t, address))
+
+	want := notify.Notification{
+		AppName: "Test",
+		Icon:    "dialog-information",
+		Summary: "Title",
+		Body:    "Message",
+		Actions: []notify.Action{{Key: "open", Label: "Open"}},
+		Urgency: notify.UrgencyCritical,
+		Expire:  5 * time.Second,
+	}
+	id, err := client.Notify(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id != 1 {
+		t.Errorf("id = %d, want 1", id)
+	}
+
+	shown := server.Notifications()
+	if len(shown) != 1 || !reflect.DeepEqual(shown[0], want) {
+		t.Errorf("notifications = %+v, want %+v", shown, want)
+	}
+
+	if _, err := client.Notify(notify.Notification{Summary: "Default", Expire: notify.ExpireDefault}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := server.Notifications()[1].Expire; got != notify.ExpireDefault {
+		t.Errorf("expire = %v, want the server default", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	address := dbustest.NewBus(t)
+	server := notifytest.NewServer(t, address)
+	client := notify.NewClient(dbustest.Connect(t, address))
+
+	events := make(chan notify.Event, 2)
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() { done <- client.Watch(func(e notify.Event) { events <- e }, stop) }()
+
+	want := []notify.Event{{ID: 1, Action: "open"}, {ID: 1, Reason: notify.ReasonDismissed}}
+	// Signals are only delivered once the match rules are added, so emit until one arrives
+	deadline := time.After(5 * time.Second)
+	var got []notify.Event
+	for len(got) == 0 {
+		if err := server.Invoke(1, "open"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("no event received")
+		}
+	}
+
+	if err := server.Close(1, notify.ReasonDismissed); err != nil {
+		t.Fatal(err)
+	}
+	for len(got) == 1 {
+		select {
+		case e := <-events:
+			// Skip repeats of the action emitted while waiting for the watch
+			if e.Action == "" {
+				got = append(got, e)
+			}
+		case <-deadline:
+			t.Fatal("no close event received")
+		}
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Package notifytest provides a stand-in notification server for tests
+package notifytest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/timmo001/go-commands/dbustest"
+	"github.com/timmo001/go-commands/notify"
+)
+
+// Server is a stand-in notification server that records the notifications it shows
+type Server struct {
+	conn *dbus.Conn
+
+	mu            sync.Mutex
+	notifications []notify.Notification
+}
+
+// NewServer exports a stand-in notification server on the bus
+func NewServer(t testing.TB, address string) *Server {
+	t.Helper()
+
+	s := &Server{conn: dbustest.Connect(t, address)}
+	err := s.conn.ExportMethodTable(map[string]any{
+		"Notify": s.notify,
+	}, notify.ObjectPath, notify.Interface)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbustest.Own(t, s.conn, notify.BusName)
+	return s
+}
+
+// Notifications returns the notifications shown so far. The ID of each is its index plus one.
+func (s *Server) Notifications() []notify.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]notify.Notification(nil), s.notifications...)
+}
+
+// Invoke reports that the user clicked an action on a notification
+func (s *Server) Invoke(id uint32, action string) error {
+	return s.conn.Emit(notify.ObjectPath, notify.Interface+".ActionInvoked", id, action)
+}
+
+// Close reports that a notification closed for a reason, e.g. notify.ReasonDismissed
+func (s *Server) Close(id uint32, reason uint32) error {
+	return s.conn.Emit(notify.ObjectPath, notify.Interface+".NotificationClosed", id, reason)
+}
+
+func (s *Server) notify(appName string, replacesID uint32, icon, summary, body string, actions []string, hints map[string]dbus.Variant, expire int32) (uint32, *dbus.Error) {
+	n := notify.Notification{
+		AppName: appName,
+		Icon:    icon,
+		Summary: summary,
+		Body:    body,
+		Expire:  time.Duration(expire) * time.Millisecond,
+	}
+	if expire < 0 {
+		n.Expire = notify.ExpireDefault
+	}
+	for i := 0; i+1 < len(actions); i += 2 {
+		n.Actions = append(n.Actions, notify.Action{Key: actions[i], Label: actions[i+1]})
+	}
+	if urgency, ok := hints["urgency"].Value().(byte); ok {
+		n.Urgency = urgency
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifications = append(s.notifications, n)
+	return uint32(len(s.notifications)), nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/mqtt"
+)
+
+// purgeWait is how long to collect retained discovery configs from the broker
+const purgeWait = 2 * time.Second
+
+// purge removes every entity of this host from Home Assistant
+func purge(cfg mqtt.Config, nodeID string, manifest *mqtt.Manifest) {
+	// Connect without availability so nothing is left retained on disconnect
+	availabilityTopic := cfg.AvailabilityTopic
+	cfg.AvailabilityTopic = ""
+	// Use a client ID of its own, as the broker would otherwise take over the
+	// session of a running daemon, which republishes everything on reconnecting
+	if cfg.ClientID != "" {
+		cfg.ClientID += "-purge"
+	}
+
+	client, err := mqtt.NewClient(cfg)
+	if err != nil {
+		log.Fatal("Failed to create MQTT client", "error", err)
+	}
+	if err := client.Connect(); err != nil {
+		log.Fatal("Failed to connect to MQTT broker", "error", err)
+	}
+	defer client.Disconnect()
+
+	if err := mqtt.Purge(client, nodeID, manifest, purgeWait); err != nil {
+		log.Fatal("Failed to purge entities", "error", err)
+	}
+	if err := client.Publish(availabilityTopic, 1, true, ""); err != nil {
+		log.Error("Failed to clear availability", "error", err)
+	}
+
+	log.Info("Removed all entities from Home Assistant", "node", nodeID)
+}
@@ -0,0 +1,225 @@
+package sensors
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/log"
+	"github.com/timmo001/go-commands/entity"
+	"github.com/timmo001/go-commands/mpris"
+)
+
+// playbackStates are the states of the now playing sensor
+var playbackStates = []string{"playing", "paused", "stopped", "idle"}
+
+// automaticPlayer is the player option that follows the active player
+const automaticPlayer = "Automatic"
+
+func init() {
+	entity.Register("media", MediaSensors)
+}
+
+// media is shared by the media entities, so the players are watched once and
+// the now playing sensor reads the status once for its state and attributes
+type media struct {
+	client *mpris.Client
+
+	// Notifier reports when a player changes
+	entity.Notifier
+
+	mu sync.Mutex
+	// stopWatch stops the watch of the players while nothing is watching
+	stopWatch chan struct{}
+	// status is the active player's status last read for the state, and
+	// running is false when no player was running
+	status  mpris.Status
+	running bool
+	err     error
+}
+
+// newMedia creates the shared state of the media entities
+func newMedia(client *mpris.Client) *media {
+	return &media{client: client}
+}
+
+// MediaSensors returns the now playing sensor and player selection when a
+// session bus is available
+func MediaSensors() []entity.Entity {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+
+	client, err := mpris.Connect()
+	if err != nil {
+		log.Warn("Media sensors unavailable", "error", err)
+		return nil
+	}
+	m := newMedia(client)
+	return []entity.Entity{nowPlayingSensor(m), playerSelect(m)}
+}
+
+// Watch calls changed whenever a player changes until stop is closed. The
+// players are watched while any entity is watching.
+func (m *media) Watch(changed func(), stop <-chan struct{}) {
+	m.mu.Lock()
+	remove := m.AddWatcher(changed)
+	if m.stopWatch == nil {
+		m.stopWatch = make(chan struct{})
+		go m.watchPlayers(m.stopWatch)
+	}
+	m.mu.Unlock()
+
+	<-stop
+
+	m.mu.Lock()
+	remove()
+	if m.Watching() == 0 {
+		close(m.stopWatch)
+		m.stopWatch = nil
+	}
+	m.mu.Unlock()
+}
+
+// watchPlayers notifies the watching entities of player changes until stop is closed
+func (m *media) watchPlayers(stop <-chan struct{}) {
+	if err := m.client.Watch(m.Notify, stop); err != nil {
+		log.Error("Failed to watch media players", "error", err)
+	}
+}
+
+// readStatus reads the active player's status, remembering it for the attributes
+func (m *media) readStatus() (mpris.Status, bool, error) {
+	var status mpris.Status
+	player, err := m.client.ActivePlayer()
+	if err == nil && player != "" {
+		status, err = m.client.Status(player)
+	}
+	running := err == nil && player != ""
+
+	m.mu.Lock()
+	m.status, m.running, m.err = status, running, err
+	m.mu.Unlock()
+	return status, running, err
+}
+
+// lastStatus returns the status last read by readStatus
+func (m *media) lastStatus() (mpris.Status, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.status, m.running, m.err
+}
+
+// nowPlayingSensor creates a sensor with the active player's playback status
+// as its state and the current track as attributes
+func nowPlayingSensor(m *media) entity.Entity {
+	return entity.Entity{
+		Component: "sensor",
+		ID:        "now_playing",
+		Name:      "Now Playing",
+		Icon:      "mdi:music",
+		Config: map[string]any{
+			"device_class": "enum",
+			"options":      playbackStates,
+		},
+		State: func() (any, error) {
+			status, ok, err := m.readStatus()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return "idle", nil
+			}
+			return playbackState(status.PlaybackStatus), nil
+		},
+		// The attributes are published after the state, so use the status it read
+		Attributes: func() (map[string]any, error) {
+			status, ok, err := m.lastStatus()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return map[string]any{}, nil
+			}
+			return map[string]any{
+				"title":    status.Title,
+				"artist":   strings.Join(status.Artists, ", "),
+				"album":    status.Album,
+				"art_url":  status.ArtURL,
+				"position": int64(status.Position.Seconds()),
+				"length":   int64(status.Length.Seconds()),
+				"player":   status.Identity,
+			}, nil
+		},
+		Watch: m.Watch,
+	}
+}
+
+// playerSelect creates a select listing the running players, which chooses
+// the player media commands and the now playing sensor use
+func playerSelect(m *media) entity.Entity {
+	return entity.Entity{
+		Component: "select",
+		ID:        "media_player",
+		Name:      "Media Player",
+		Icon:      "mdi:speaker-multiple",
+		DynamicConfig: func() (map[string]any, error) {
+			players, err := m.client.Players()
+			if err != nil {
+				return nil, err
+			}
+			options := []string{automaticPlayer}
+			for _, player := range players {
+				options = append(options, playerOption(player))
+			}
+			return map[string]any{"options": options}, nil
+		},
+		State: func() (any, error) {
+			players, err := m.client.Players()
+			if err != nil {
+				return nil, err
+			}
+			// A selected player that has exited is not an option, so show
+			// that the active player is chosen automatically until it returns
+			if selected := mpris.SelectedPlayer(); slices.Contains(players, selected) {
+				return playerOption(selected), nil
+			}
+			return automaticPlayer, nil
+		},
+		Command: func(payload string) error {
+			if payload == automaticPlayer {
+				mpris.SelectPlayer("")
+				return nil
+			}
+
+			players, err := m.client.Players()
+			if err != nil {
+				return err
+			}
+			player := mpris.BusPrefix + payload
+			if !slices.Contains(players, player) {
+				return fmt.Errorf("media player %q is not running", payload)
+			}
+			mpris.SelectPlayer(player)
+			return nil
+		},
+		Watch: m.Watch,
+	}
+}
+
+// playerOption returns the select option for a player's bus name, e.g. spotify
+func playerOption(player string) string {
+	return strings.TrimPrefix(player, mpris.BusPrefix)
+}
+
+// playbackState converts an MPRIS PlaybackStatus to a sensor state
+func playbackState(status string) string {
+	switch status {
+	case "Playing", "Paused", "Stopped":
+		return strings.ToLower(status)
+	}
+	return "idle"
+}
@@ -0,0 +1,143 @@
+package sensors
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timmo001/go-commands/mpris"
+	"github.com/timmo001/go-commands/mpris/mpristest"
+)
+
+func TestNowPlayingSensor(t *testing.T) {
+	address := mpristest.NewBus(t)
+	sensor := nowPlayingSensor(newMedia(mpris.NewClient(mpristest.Connect(t, address))))
+
+	if state, err := sensor.State(); err != nil || state != "idle" {
+		t.Errorf("state without players = %v, %v, want idle", state, err)
+	}
+
+	player := mpristest.NewPlayer(t, address, "spotify", "Spotify")
+	player.Set("PlaybackStatus", "Paused")
+	player.Set("Position", int64(61_500_000))
+	player.SetTrack("Song", []string{"Artist A", "Artist B"}, "Album", 200_000_000)
+
+	if state, err := sensor.State(); err != nil || state != "paused" {
+		t.Errorf("state = %v, %v, want paused", state, err)
+	}
+
+	attributes, err := sensor.Attributes()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]any{
+		"title":    "Song",
+		"artist":   "Artist A, Artist B",
+		"album":    "Album",
+		"position": int64(61),
+		"length":   int64(200),
+		"player":   "Spotify",
+	}
+	for key, value := range want {
+		if attributes[key] != value {
+			t.Errorf("%s = %v, want %v", key, attributes[key], value)
+		}
+	}
+}
+
+func TestPlayerSelect(t *testing.T) {
+	address := mpristest.NewBus(t)
+	m := newMedia(mpris.NewClient(mpristest.Connect(t, address)))
+	selector := playerSelect(m)
+	nowPlaying := nowPlayingSensor(m)
+	t.Cleanup(func() { mpris.SelectPlayer("") })
+
+	options := func() []string {
+		t.Helper()
+		config, err := selector.DynamicConfig()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return config["options"].([]string)
+	}
+
+	if got := options(); !slices.Equal(got, []string{"Automatic"}) {
+		t.Errorf("options without players = %v", got)
+	}
+
+	mpristest.NewPlayer(t, address, "mpv", "mpv")
+	spotify := mpristest.NewPlayer(t, address, "spotify", "Spotify")
+	spotify.Set("PlaybackStatus", "Playing")
+
+	if got := options(); !slices.Equal(got, []string{"Automatic", "mpv", "spotify"}) {
+		t.Errorf("options = %v", got)
+	}
+
+	if err := selector.Command("vlc"); err == nil {
+		t.Error("expected an error selecting a player that is not running")
+	}
+	if err := selector.Command("mpv"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state, _ := selector.State(); state != "mpv" {
+		t.Errorf("state = %v, want mpv", state)
+	}
+	if state, _ := nowPlaying.State(); state != "stopped" {
+		t.Errorf("now playing = %v, want the selected player's state", state)
+	}
+
+	if err := selector.Command("Automatic"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if state, _ := selector.State(); state != "Automatic" {
+		t.Errorf("state = %v, want Automatic", state)
+	}
+	if state, _ := nowPlaying.State(); state != "playing" {
+		t.Errorf("now playing = %v, want the playing player's state", state)
+	}
+}
+
+func TestMediaSharesWatch(t *testing.T) {
+	address := mpristest.NewBus(t)
+	m := newMedia(mpris.NewClient(mpristest.Connect(t, address)))
+
+	nowPlaying := make(chan struct{}, 16)
+	selector := make(chan struct{}, 16)
+	stop := make(chan struct{})
+	var done sync.WaitGroup
+	for _, changes := range []chan struct{}{nowPlaying, selector} {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			m.Watch(func() { changes <- struct{}{} }, stop)
+		}()
+	}
+
+	// Start players until the watch has registered and reports one starting
+	deadline := time.After(5 * time.Second)
+	for started := false; !started; {
+		p := mpristest.NewPlayer(t, address, "vlc", "VLC")
+		select {
+		case <-nowPlaying:
+			started = true
+		case <-time.After(100 * time.Millisecond):
+			p.Close()
+		case <-deadline:
+			t.Fatal("watch never reported a player starting")
+		}
+	}
+	select {
+	case <-selector:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the player select was not told about the change")
+	}
+
+	close(stop)
+	done.Wait()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopWatch != nil {
+		t.Error("players are still watched after every entity stopped watching")
+	}
+}
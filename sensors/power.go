@@ -0,0 +1,252 @@
+package sensors
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/timmo001/go-commands/entity"
+)
+
+// sysRoot is where the sys filesystem is mounted
+var sysRoot = "/sys"
+
+func init() {
+	entity.Register("power", PowerSensors)
+}
+
+// PowerSensors returns the battery, AC adapter and lid entities for the
+// hardware that is present
+func PowerSensors() []entity.Entity {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return powerSensors(sysRoot, procRoot)
+}
+
+func powerSensors(sys, proc string) []entity.Entity {
+	var sensors []entity.Entity
+
+	supplies, _ := filepath.Glob(filepath.Join(sys, "class", "power_supply", "*"))
+
+	var batteries, mains []string
+	for _, supply := range supplies {
+		switch readString(filepath.Join(supply, "type")) {
+		case "Battery":
+			// Skip peripherals such as wireless mice that report their own battery
+			if readString(filepath.Join(supply, "scope")) == "Device" {
+				continue
+			}
+			batteries = append(batteries, supply)
+		case "Mains":
+			mains = append(mains, supply)
+		}
+	}
+	for _, supply := range mains {
+		suffix := ""
+		if len(mains) > 1 {
+			suffix = " " + filepath.Base(supply)
+		}
+		sensors = append(sensors, acSensor(supply, suffix))
+	}
+	for _, battery := range batteries {
+		suffix := ""
+		if len(batteries) > 1 {
+			suffix = " " + filepath.Base(battery)
+		}
+		sensors = append(sensors, batterySensors(battery, suffix)...)
+	}
+
+	lids, _ := filepath.Glob(filepath.Join(proc, "acpi", "button", "lid", "*", "state"))
+	if len(lids) > 0 {
+		sensors = append(sensors, lidSensor(lids[0]))
+	}
+
+	return sensors
+}
+
+// batterySensors creates the level, charging and time remaining entities for a battery
+func batterySensors(path, suffix string) []entity.Entity {
+	name := func(name string) string { return name + suffix }
+
+	return []entity.Entity{
+		{
+			Component: "sensor",
+			ID:        entity.ID(name("Battery")),
+			Name:      name("Battery"),
+			Config: map[string]any{
+				"device_class":        "battery",
+				"state_class":         "measurement",
+				"unit_of_measurement": "%",
+			},
+			State: func() (any, error) {
+				return readInt(filepath.Join(path, "capacity"))
+			},
+			Attributes: func() (map[string]any, error) {
+				return batteryAttributes(path), nil
+			},
+		},
+		{
+			Component: "binary_sensor",
+			ID:        entity.ID(name("Battery Charging")),
+			Name:      name("Battery Charging"),
+			Config: map[string]any{
+				"device_class": "battery_charging",
+			},
+			State: func() (any, error) {
+				status, err := os.ReadFile(filepath.Join(path, "status"))
+				if err != nil {
+					return nil, err
+				}
+				return entity.OnOff(strings.TrimSpace(string(status)) == "Charging"), nil
+			},
+		},
+		{
+			Component: "sensor",
+			ID:        entity.ID(name("Battery Time Remaining")),
+			Name:      name("Battery Time Remaining"),
+			Icon:      "mdi:battery-clock",
+			Config: map[string]any{
+				"device_class":        "duration",
+				"state_class":         "measurement",
+				"unit_of_measurement": "min",
+			},
+			State: func() (any, error) {
+				minutes, ok := batteryMinutesRemaining(path)
+				if !ok {
+					return entity.Unknown, nil
+				}
+				return minutes, nil
+			},
+		},
+	}
+}
+
+// batteryMinutesRemaining estimates the minutes until the battery is empty
+// when discharging, or full when charging, from the current power draw
+func batteryMinutesRemaining(path string) (int64, bool) {
+	status := readString(filepath.Join(path, "status"))
+
+	// Batteries report either energy in µWh and power in µW, or charge in µAh and current in µA
+	now, errNow := readInt(filepath.Join(path, "energy_now"))
+	full, errFull := readInt(filepath.Join(path, "energy_full"))
+	rate, errRate := readInt(filepath.Join(path, "power_now"))
+	if errNow != nil || errFull != nil || errRate != nil {
+		now, errNow = readInt(filepath.Join(path, "charge_now"))
+		full, errFull = readInt(filepath.Join(path, "charge_full"))
+		rate, errRate = readInt(filepath.Join(path, "current_now"))
+		if errNow != nil || errFull != nil || errRate != nil {
+			return 0, false
+		}
+	}
+	// Some drivers report a negative rate while discharging
+	if rate < 0 {
+		rate = -rate
+	}
+	if rate == 0 {
+		return 0, false
+	}
+
+	var remaining int64
+	switch status {
+	case "Discharging":
+		remaining = now
+	case "Charging":
+		remaining = full - now
+	default:
+		return 0, false
+	}
+	return int64(math.Round(float64(remaining) / float64(rate) * 60)), true
+}
+
+// batteryAttributes returns the battery details that are available
+func batteryAttributes(path string) map[string]any {
+	attributes := map[string]any{}
+	for _, key := range []string{"status", "technology", "manufacturer", "model_name"} {
+		if value := readString(filepath.Join(path, key)); value != "" {
+			attributes[key] = value
+		}
+	}
+	if cycles, err := readInt(filepath.Join(path, "cycle_count")); err == nil && cycles > 0 {
+		attributes["cycle_count"] = cycles
+	}
+
+	full, errFull := readInt(filepath.Join(path, "energy_full"))
+	design, errDesign := readInt(filepath.Join(path, "energy_full_design"))
+	if errFull != nil || errDesign != nil {
+		full, errFull = readInt(filepath.Join(path, "charge_full"))
+		design, errDesign = readInt(filepath.Join(path, "charge_full_design"))
+	}
+	if errFull == nil && errDesign == nil && design > 0 {
+		attributes["health"] = round(percent(float64(full), float64(design)), 1)
+	}
+	return attributes
+}
+
+// acSensor creates the entity reporting whether an AC adapter is plugged in.
+// The suffix tells adapters apart when there is more than one.
+func acSensor(path, suffix string) entity.Entity {
+	return entity.Entity{
+		Component: "binary_sensor",
+		ID:        entity.ID("AC Power" + suffix),
+		Name:      "AC Power" + suffix,
+		Config: map[string]any{
+			"device_class": "plug",
+		},
+		State: func() (any, error) {
+			online, err := readInt(filepath.Join(path, "online"))
+			if err != nil {
+				return nil, err
+			}
+			return entity.OnOff(online == 1), nil
+		},
+	}
+}
+
+// lidSensor creates the entity reporting whether the laptop lid is closed
+func lidSensor(path string) entity.Entity {
+	return entity.Entity{
+		Component: "binary_sensor",
+		ID:        "lid_closed",
+		Name:      "Lid Closed",
+		Icon:      "mdi:laptop",
+		State: func() (any, error) {
+			// e.g. "state:      open"
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			_, state, ok := strings.Cut(string(data), ":")
+			if !ok {
+				return nil, fmt.Errorf("unexpected format in %s", path)
+			}
+			return entity.OnOff(strings.TrimSpace(state) == "closed"), nil
+		},
+	}
+}
+
+// readString returns the trimmed contents of a file, or "" if it cannot be read
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readInt parses a file containing a single integer
+func readInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value in %s: %v", path, err)
+	}
+	return value, nil
+}
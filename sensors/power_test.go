@@ -0,0 +1,153 @@
+package sensors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/timmo001/go-commands/entity"
+)
+
+// writeTree creates files relative to a temporary root and returns the root
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// states reads the state of every entity, keyed by component and ID
+func states(t *testing.T, entities []entity.Entity) map[string]any {
+	t.Helper()
+
+	result := map[string]any{}
+	for _, e := range entities {
+		state, err := e.State()
+		if err != nil {
+			t.Errorf("%s %s: unexpected error: %v", e.Component, e.ID, err)
+		}
+		result[e.Component+"."+e.ID] = state
+	}
+	return result
+}
+
+func TestPowerSensorsLaptop(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"sys/class/power_supply/AC/type":                  "Mains\n",
+		"sys/class/power_supply/AC/online":                "0\n",
+		"sys/class/power_supply/BAT0/type":                "Battery\n",
+		"sys/class/power_supply/BAT0/status":              "Discharging\n",
+		"sys/class/power_supply/BAT0/capacity":            "64\n",
+		"sys/class/power_supply/BAT0/energy_now":          "32000000\n",
+		"sys/class/power_supply/BAT0/energy_full":         "50000000\n",
+		"sys/class/power_supply/BAT0/energy_full_design":  "57000000\n",
+		"sys/class/power_supply/BAT0/power_now":           "8000000\n",
+		"sys/class/power_supply/BAT0/technology":          "Li-poly\n",
+		"sys/class/power_supply/hidpp_battery_0/type":     "Battery\n",
+		"sys/class/power_supply/hidpp_battery_0/scope":    "Device\n",
+		"sys/class/power_supply/hidpp_battery_0/capacity": "20\n",
+		"proc/acpi/button/lid/LID0/state":                 "state:      closed\n",
+	})
+
+	entities := powerSensors(filepath.Join(root, "sys"), filepath.Join(root, "proc"))
+	got := states(t, entities)
+
+	want := map[string]any{
+		"binary_sensor.ac_power":         "OFF",
+		"sensor.battery":                 int64(64),
+		"binary_sensor.battery_charging": "OFF",
+		"sensor.battery_time_remaining":  int64(240),
+		"binary_sensor.lid_closed":       "ON",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got entities %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+
+	for _, e := range entities {
+		if e.ID != "battery" {
+			continue
+		}
+		attributes, _ := e.Attributes()
+		if attributes["technology"] != "Li-poly" || attributes["health"] != 87.7 {
+			t.Errorf("attributes = %v", attributes)
+		}
+	}
+}
+
+func TestPowerSensorsChargingWithCharge(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"sys/class/power_supply/BAT0/type":        "Battery\n",
+		"sys/class/power_supply/BAT0/status":      "Charging\n",
+		"sys/class/power_supply/BAT0/capacity":    "50\n",
+		"sys/class/power_supply/BAT0/charge_now":  "2000000\n",
+		"sys/class/power_supply/BAT0/charge_full": "4000000\n",
+		"sys/class/power_supply/BAT0/current_now": "-1000000\n",
+		"sys/class/power_supply/BAT1/type":        "Battery\n",
+		"sys/class/power_supply/BAT1/status":      "Full\n",
+		"sys/class/power_supply/BAT1/capacity":    "100\n",
+	})
+
+	got := states(t, powerSensors(filepath.Join(root, "sys"), filepath.Join(root, "proc")))
+
+	want := map[string]any{
+		"sensor.battery_bat0":                 int64(50),
+		"binary_sensor.battery_charging_bat0": "ON",
+		"sensor.battery_time_remaining_bat0":  int64(120),
+		"sensor.battery_bat1":                 int64(100),
+		"binary_sensor.battery_charging_bat1": "OFF",
+		"sensor.battery_time_remaining_bat1":  entity.Unknown,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got entities %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestPowerSensorsSeveralAdapters(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"sys/class/power_supply/ACAD/type":                          "Mains\n",
+		"sys/class/power_supply/ACAD/online":                        "0\n",
+		"sys/class/power_supply/ucsi-source-psy-USBC000:001/type":   "Mains\n",
+		"sys/class/power_supply/ucsi-source-psy-USBC000:001/online": "1\n",
+	})
+
+	got := states(t, powerSensors(filepath.Join(root, "sys"), filepath.Join(root, "proc")))
+
+	want := map[string]any{
+		"binary_sensor.ac_power_acad":                        "OFF",
+		"binary_sensor.ac_power_ucsi_source_psy_usbc000_001": "ON",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got entities %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestPowerSensorsDesktop(t *testing.T) {
+	root := t.TempDir()
+	if entities := powerSensors(filepath.Join(root, "sys"), filepath.Join(root, "proc")); len(entities) != 0 {
+		t.Errorf("expected no entities without hardware, got %d", len(entities))
+	}
+}
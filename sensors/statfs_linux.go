@@ -0,0 +1,20 @@
+package sensors
+
+import "syscall"
+
+// statDisk returns the usage of the filesystem mounted at path
+func statDisk(path string) (diskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return diskUsage{}, err
+	}
+
+	blockSize := uint64(st.Bsize)
+	total := st.Blocks * blockSize
+	return diskUsage{
+		total: total,
+		// Reserved blocks count as used, like df
+		used:      total - st.Bfree*blockSize,
+		available: st.Bavail * blockSize,
+	}, nil
+}
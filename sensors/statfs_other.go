@@ -0,0 +1,13 @@
+//go:build !linux
+
+package sensors
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// statDisk returns the usage of the filesystem mounted at path
+func statDisk(path string) (diskUsage, error) {
+	return diskUsage{}, fmt.Errorf("disk usage not supported on %s", runtime.GOOS)
+}
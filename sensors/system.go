@@ -0,0 +1,420 @@
+package sensors
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/timmo001/go-commands/entity"
+)
+
+// procRoot is where the proc filesystem is mounted
+var procRoot = "/proc"
+
+func init() {
+	entity.Register("system", SystemSensors)
+}
+
+// SystemSensors returns the CPU, memory, load, uptime and disk usage sensors
+func SystemSensors() []entity.Entity {
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	return systemSensors(procRoot)
+}
+
+func systemSensors(proc string) []entity.Entity {
+	cpu := &cpuSampler{path: filepath.Join(proc, "stat"), previous: map[string]cpuTimes{}}
+	meminfo := filepath.Join(proc, "meminfo")
+	loadavg := filepath.Join(proc, "loadavg")
+
+	sensors := []entity.Entity{
+		percentSensor("cpu_usage", "CPU Usage", "mdi:cpu-64-bit", func() (float64, error) {
+			return cpu.usage("cpu")
+		}),
+	}
+
+	cores, _ := cpu.cores()
+	for _, core := range cores {
+		index := strings.TrimPrefix(core, "cpu")
+		sensors = append(sensors, percentSensor(
+			fmt.Sprintf("cpu_core_%s_usage", index),
+			fmt.Sprintf("CPU Core %s Usage", index),
+			"mdi:cpu-64-bit",
+			func() (float64, error) { return cpu.usage(core) },
+		))
+	}
+
+	sensors = append(sensors,
+		percentSensor("memory_usage", "Memory Usage", "mdi:memory", func() (float64, error) {
+			mem, err := readMeminfo(meminfo)
+			if err != nil {
+				return 0, err
+			}
+			return percent(mem["MemTotal"]-mem["MemAvailable"], mem["MemTotal"]), nil
+		}),
+		entity.Entity{
+			Component: "sensor",
+			ID:        "memory_used",
+			Name:      "Memory Used",
+			Icon:      "mdi:memory",
+			Config: map[string]any{
+				"device_class":        "data_size",
+				"state_class":         "measurement",
+				"unit_of_measurement": "MiB",
+			},
+			State: func() (any, error) {
+				mem, err := readMeminfo(meminfo)
+				if err != nil {
+					return nil, err
+				}
+				// meminfo reports kibibytes
+				return round((mem["MemTotal"]-mem["MemAvailable"])/1024, 1), nil
+			},
+		},
+		percentSensor("swap_usage", "Swap Usage", "mdi:swap-horizontal", func() (float64, error) {
+			mem, err := readMeminfo(meminfo)
+			if err != nil {
+				return 0, err
+			}
+			return percent(mem["SwapTotal"]-mem["SwapFree"], mem["SwapTotal"]), nil
+		}),
+	)
+
+	for i, period := range []string{"1m", "5m", "15m"} {
+		sensors = append(sensors, entity.Entity{
+			Component: "sensor",
+			ID:        "load_average_" + period,
+			Name:      fmt.Sprintf("Load Average (%s)", period),
+			Icon:      "mdi:gauge",
+			Config: map[string]any{
+				"state_class": "measurement",
+			},
+			State: func() (any, error) {
+				loads, err := readLoadavg(loadavg)
+				if err != nil {
+					return nil, err
+				}
+				return loads[i], nil
+			},
+		})
+	}
+
+	sensors = append(sensors, entity.Entity{
+		Component: "sensor",
+		ID:        "uptime",
+		Name:      "Uptime",
+		Icon:      "mdi:timer-outline",
+		Config: map[string]any{
+			"device_class":        "duration",
+			"state_class":         "measurement",
+			"unit_of_measurement": "s",
+		},
+		State: func() (any, error) {
+			return readUptime(filepath.Join(proc, "uptime"))
+		},
+	})
+
+	mounts, _ := readMounts(filepath.Join(proc, "mounts"))
+	for _, mnt := range mounts {
+		sensors = append(sensors, diskSensor(mnt))
+	}
+
+	return sensors
+}
+
+// percentSensor creates a sensor reporting a percentage
+func percentSensor(id, name, icon string, read func() (float64, error)) entity.Entity {
+	return entity.Entity{
+		Component: "sensor",
+		ID:        id,
+		Name:      name,
+		Icon:      icon,
+		Config: map[string]any{
+			"state_class":         "measurement",
+			"unit_of_measurement": "%",
+		},
+		State: func() (any, error) {
+			value, err := read()
+			if err != nil {
+				return nil, err
+			}
+			return round(value, 1), nil
+		},
+	}
+}
+
+// diskSensor creates a sensor reporting the usage of a mounted filesystem
+func diskSensor(mnt mount) entity.Entity {
+	usage := func() (diskUsage, error) { return statDisk(mnt.path) }
+
+	name := "Disk Usage " + mnt.path
+	id := entity.ID(name)
+	if mnt.path == "/" {
+		id = "disk_usage_root"
+	}
+
+	return entity.Entity{
+		Component: "sensor",
+		ID:        id,
+		Name:      name,
+		Icon:      "mdi:harddisk",
+		Config: map[string]any{
+			"state_class":         "measurement",
+			"unit_of_measurement": "%",
+		},
+		State: func() (any, error) {
+			disk, err := usage()
+			if err != nil {
+				return nil, err
+			}
+			return round(percent(float64(disk.used), float64(disk.used+disk.available)), 1), nil
+		},
+		Attributes: func() (map[string]any, error) {
+			disk, err := usage()
+			if err != nil {
+				return nil, err
+			}
+			return map[string]any{
+				"mount":           mnt.path,
+				"device":          mnt.device,
+				"filesystem":      mnt.fsType,
+				"total_bytes":     disk.total,
+				"used_bytes":      disk.used,
+				"available_bytes": disk.available,
+			}, nil
+		},
+	}
+}
+
+// cpuTimes are the cumulative busy and total jiffies of a CPU
+type cpuTimes struct {
+	busy  uint64
+	total uint64
+}
+
+// cpuSampler computes CPU usage from the change in /proc/stat between reads
+type cpuSampler struct {
+	path string
+
+	mu       sync.Mutex
+	previous map[string]cpuTimes
+}
+
+// usage returns the usage of a CPU line (cpu, cpu0, ...) since the previous
+// read, or since boot on the first read
+func (s *cpuSampler) usage(name string) (float64, error) {
+	times, err := readCPUTimes(s.path)
+	if err != nil {
+		return 0, err
+	}
+	current, ok := times[name]
+	if !ok {
+		return 0, fmt.Errorf("%s not found in %s", name, s.path)
+	}
+
+	s.mu.Lock()
+	previous := s.previous[name]
+	s.previous[name] = current
+	s.mu.Unlock()
+
+	return percent(float64(current.busy-previous.busy), float64(current.total-previous.total)), nil
+}
+
+// cores returns the names of the per-core lines in /proc/stat
+func (s *cpuSampler) cores() ([]string, error) {
+	times, err := readCPUTimes(s.path)
+	if err != nil {
+		return nil, err
+	}
+	var cores []string
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("cpu%d", i)
+		if _, ok := times[name]; !ok {
+			return cores, nil
+		}
+		cores = append(cores, name)
+	}
+}
+
+// readCPUTimes parses the cpu lines of /proc/stat
+func readCPUTimes(path string) (map[string]cpuTimes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	times := map[string]cpuTimes{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		var t cpuTimes
+		for i, field := range fields[1:] {
+			value, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s value %q: %v", fields[0], field, err)
+			}
+			// guest and guest_nice are already counted in user and nice
+			if i >= 8 {
+				break
+			}
+			t.total += value
+			// idle and iowait are the 4th and 5th columns
+			if i != 3 && i != 4 {
+				t.busy += value
+			}
+		}
+		times[fields[0]] = t
+	}
+	return times, scanner.Err()
+}
+
+// readMeminfo parses /proc/meminfo into values in kibibytes
+func readMeminfo(path string) (map[string]float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]float64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, rest, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+		values[key] = value
+	}
+	if _, ok := values["MemTotal"]; !ok {
+		return nil, fmt.Errorf("MemTotal not found in %s", path)
+	}
+	return values, scanner.Err()
+}
+
+// readLoadavg parses the 1, 5 and 15 minute load averages from /proc/loadavg
+func readLoadavg(path string) ([3]float64, error) {
+	var loads [3]float64
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return loads, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return loads, fmt.Errorf("unexpected format in %s", path)
+	}
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return loads, fmt.Errorf("invalid load average %q: %v", fields[i], err)
+		}
+	}
+	return loads, nil
+}
+
+// readUptime parses the system uptime in whole seconds from /proc/uptime
+func readUptime(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected format in %s", path)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid uptime %q: %v", fields[0], err)
+	}
+	return int64(seconds), nil
+}
+
+// mount is a mounted filesystem backed by a block device
+type mount struct {
+	device string
+	path   string
+	fsType string
+}
+
+// readMounts returns the block device filesystems in /proc/mounts, once per device
+func readMounts(path string) ([]mount, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mounts []mount
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		device, fsType := fields[0], fields[2]
+		// Skip virtual filesystems, loop devices such as snaps, and bind mounts
+		if !strings.HasPrefix(device, "/dev/") || strings.HasPrefix(device, "/dev/loop") || fsType == "squashfs" || seen[device] {
+			continue
+		}
+		seen[device] = true
+		mounts = append(mounts, mount{device: device, path: unescapeMount(fields[1]), fsType: fsType})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMount decodes the octal escapes used for spaces and tabs in /proc/mounts
+func unescapeMount(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// diskUsage is the size of a filesystem in bytes
+type diskUsage struct {
+	total     uint64
+	used      uint64
+	available uint64
+}
+
+// percent returns part as a percentage of whole, or 0 if whole is 0
+func percent(part, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return part / whole * 100
+}
+
+// round rounds a value to a number of decimal places
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
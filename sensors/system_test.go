@@ -0,0 +1,116 @@
+package sensors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testProc = "testdata/proc"
+
+func TestReadCPUTimes(t *testing.T) {
+	times, err := readCPUTimes(filepath.Join(testProc, "stat"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := times["cpu"]; got.busy != 500 || got.total != 1000 {
+		t.Errorf("cpu = %+v, want busy 500 total 1000", got)
+	}
+	if len(times) != 3 {
+		t.Errorf("got %d cpu lines, want 3", len(times))
+	}
+}
+
+func TestCPUSamplerUsesDelta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stat")
+	write := func(contents string) {
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sampler := &cpuSampler{path: path, previous: map[string]cpuTimes{}}
+	write("cpu  100 0 0 100 0 0 0 0 0 0\n")
+	if usage, err := sampler.usage("cpu"); err != nil || usage != 50 {
+		t.Fatalf("first usage = %v, %v, want 50", usage, err)
+	}
+
+	// 90 busy jiffies out of 100 since the previous read
+	write("cpu  190 0 0 110 0 0 0 0 0 0\n")
+	if usage, err := sampler.usage("cpu"); err != nil || usage != 90 {
+		t.Fatalf("second usage = %v, %v, want 90", usage, err)
+	}
+}
+
+func TestReadMounts(t *testing.T) {
+	mounts, err := readMounts(filepath.Join(testProc, "mounts"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []mount{
+		{device: "/dev/nvme0n1p2", path: "/", fsType: "ext4"},
+		{device: "/dev/nvme0n1p1", path: "/boot/efi", fsType: "vfat"},
+		{device: "/dev/sda1", path: "/mnt/My Disk", fsType: "ext4"},
+	}
+	if len(mounts) != len(want) {
+		t.Fatalf("mounts = %+v, want %+v", mounts, want)
+	}
+	for i := range want {
+		if mounts[i] != want[i] {
+			t.Errorf("mounts[%d] = %+v, want %+v", i, mounts[i], want[i])
+		}
+	}
+}
+
+func TestSystemSensors(t *testing.T) {
+	states := map[string]any{}
+	for _, e := range systemSensors(testProc) {
+		if e.Component != "sensor" {
+			t.Errorf("%s: component = %q", e.ID, e.Component)
+		}
+		if e.State == nil {
+			t.Errorf("%s: no state", e.ID)
+			continue
+		}
+		// Disk sensors stat the real mount points, which do not exist here
+		if _, ok := e.Config["unit_of_measurement"]; ok && e.Attributes != nil {
+			states[e.ID] = nil
+			continue
+		}
+		state, err := e.State()
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", e.ID, err)
+		}
+		states[e.ID] = state
+	}
+
+	want := map[string]any{
+		"cpu_usage":              50.0,
+		"cpu_core_0_usage":       50.0,
+		"cpu_core_1_usage":       50.0,
+		"memory_usage":           75.0,
+		"memory_used":            6000.0,
+		"swap_usage":             25.0,
+		"load_average_1m":        0.52,
+		"load_average_5m":        0.58,
+		"load_average_15m":       0.59,
+		"uptime":                 int64(3723),
+		"disk_usage_root":        nil,
+		"disk_usage_boot_efi":    nil,
+		"disk_usage_mnt_my_disk": nil,
+	}
+	for id, value := range want {
+		got, ok := states[id]
+		if !ok {
+			t.Errorf("missing sensor %s", id)
+			continue
+		}
+		if got != value {
+			t.Errorf("%s = %v, want %v", id, got, value)
+		}
+	}
+	if len(states) != len(want) {
+		t.Errorf("got %d sensors, want %d", len(states), len(want))
+	}
+}
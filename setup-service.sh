@@ -21,6 +21,11 @@ mkdir -p ~/.local/go-commands
 # Copy .env file to working directory
 cp .env ~/.local/go-commands
 
+# Copy config file to working directory if it exists
+if [ -f config.yml ]; then
+    cp config.yml ~/.local/go-commands
+fi
+
 # Configure sudo privileges for efibootmgr
 echo "# Allow go-commands to use efibootmgr without password
 $USER ALL=(ALL) NOPASSWD: /usr/bin/efibootmgr" | sudo tee /etc/sudoers.d/go-commands
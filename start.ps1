@@ -10,6 +10,11 @@ if (-not (Test-Path -Path $WorkingDir)) {
 # Copy .env file to working directory
 Copy-Item -Path .env -Destination $WorkingDir -Force
 
+# Copy config file to working directory if it exists
+if (Test-Path -Path config.yml) {
+    Copy-Item -Path config.yml -Destination $WorkingDir -Force
+}
+
 # Set working directory
 Set-Location -Path $WorkingDir
 
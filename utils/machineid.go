@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// machineIDFiles are read in order to find the machine ID on Linux
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+var (
+	macPlatformUUID = regexp.MustCompile(`"IOPlatformUUID" = "([^"]+)"`)
+	windowsGUID     = regexp.MustCompile(`MachineGuid\s+REG_SZ\s+(\S+)`)
+)
+
+// GetMachineID returns a stable identifier for this machine or "" if it cannot be determined
+func GetMachineID() string {
+	switch runtime.GOOS {
+	case "linux":
+		for _, path := range machineIDFiles {
+			if data, err := os.ReadFile(path); err == nil {
+				if id := strings.TrimSpace(string(data)); id != "" {
+					return id
+				}
+			}
+		}
+	case "darwin":
+		output, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err == nil {
+			if match := macPlatformUUID.FindSubmatch(output); match != nil {
+				return string(match[1])
+			}
+		}
+	case "windows":
+		output, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if err == nil {
+			if match := windowsGUID.FindSubmatch(output); match != nil {
+				return string(match[1])
+			}
+		}
+	}
+	return ""
+}